@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"agora/src/audit"
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/x/date"
+	_ "embed"
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// viewerLimit keeps the page small, the export has all entries
+const viewerLimit = 200
+
+//go:embed audit-log.html
+var auditLogTemplate string
+
+func (adh *AdminHandler) AuditLogGETHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can read the audit log", http.StatusForbidden)
+		return
+	}
+
+	filter := parseFilter(r)
+	entries, err := adh.ah.QueryEntries(filter, viewerLimit+1)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query audit log", "err", err)
+		http.Error(w, "Could not retrieve audit log", http.StatusInternalServerError)
+		return
+	}
+
+	truncated := len(entries) > viewerLimit
+	if truncated {
+		entries = entries[:viewerLimit]
+	}
+	for i := range entries {
+		entries[i].CreatedAt = date.FormatDate(entries[i].CreatedAt)
+	}
+
+	render.RenderTemplate(
+		w,
+		"audit-log.html",
+		&render.Page{
+			Title: "Audit log",
+			Data: struct {
+				Entries   []audit.Entry
+				Filter    audit.Filter
+				Actions   []audit.Action
+				Truncated bool
+				Limit     int
+				Query     string
+			}{
+				Entries:   entries,
+				Filter:    filter,
+				Actions:   audit.Actions,
+				Truncated: truncated,
+				Limit:     viewerLimit,
+				Query:     r.URL.RawQuery,
+			},
+		},
+		r.Context(),
+		auditLogTemplate,
+	)
+}
+
+// AuditLogCSVHandler exports all entries matching the filter of the viewer
+func (adh *AdminHandler) AuditLogCSVHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsAdmin() {
+		http.Error(w, "Only admins can read the audit log", http.StatusForbidden)
+		return
+	}
+
+	entries, err := adh.ah.QueryEntries(parseFilter(r), 0)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query audit log for export", "err", err)
+		http.Error(w, "Could not export audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="agora-audit-log.csv"`)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "created_at", "action", "actor_id", "actor_name", "target_type", "target_id", "details", "ip", "user_agent"})
+	for _, entry := range entries {
+		writer.Write(csvRow(
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt,
+			string(entry.Action),
+			entry.ActorID,
+			entry.FActorName,
+			entry.TargetType,
+			entry.TargetID,
+			entry.Details,
+			entry.IP,
+			entry.UserAgent,
+		))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "could not write audit log export", "err", err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "exported audit log", "entries", len(entries), "userID", user.ID)
+}
+
+// csvRow keeps spreadsheets from running cells as formulas. Details,
+// names and user agents are user controlled, a leading ' makes them text.
+func csvRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+func parseFilter(r *http.Request) audit.Filter {
+	query := r.URL.Query()
+	return audit.Filter{
+		Action:     audit.Action(strings.TrimSpace(query.Get("action"))),
+		Actor:      strings.TrimSpace(query.Get("actor")),
+		TargetType: strings.TrimSpace(query.Get("target_type")),
+		TargetID:   strings.TrimSpace(query.Get("target_id")),
+		From:       validDate(query.Get("from")),
+		To:         validDate(query.Get("to")),
+	}
+}
+
+// validDate drops anything that is not a date input value,
+// SQLite would compare it as text and silently match nothing
+func validDate(value string) string {
+	if _, err := time.Parse(time.DateOnly, value); err != nil {
+		return ""
+	}
+	return value
+}
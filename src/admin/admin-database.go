@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"agora/src/user"
+	"strings"
+	"time"
+)
+
+func (adh *AdminHandler) queryUsers() ([]UserRow, error) {
+	rows, err := adh.db.Query(
+		`SELECT
+			u.id, u.name, u.email, u.role, u.created_at, u.last_login_at,
+			` + user.SuspendedColumn + `, u.disabled_until,
+			(SELECT count(*) FROM posts p WHERE p.fk_user_id = u.id),
+			(SELECT count(*) FROM comments c WHERE c.fk_user_id = u.id),
+			(SELECT count(*) FROM votes v WHERE v.fk_user_id = u.id)
+		FROM users u
+		ORDER BY u.created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserRow
+	for rows.Next() {
+		var row UserRow
+		if err := rows.Scan(
+			&row.ID,
+			&row.Name,
+			&row.Email,
+			&row.Role,
+			&row.CreatedAt,
+			&row.LastLoginAt,
+			&row.Suspended,
+			&row.SuspendedUntil,
+			&row.FNrOfPosts,
+			&row.FNrOfComments,
+			&row.FNrOfVotes,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, row)
+	}
+	return users, rows.Err()
+}
+
+func (adh *AdminHandler) queryTotals() (Totals, error) {
+	var totals Totals
+	err := adh.db.QueryRow(
+		`SELECT
+			(SELECT count(*) FROM users),
+			(SELECT count(*) FROM posts),
+			(SELECT count(*) FROM comments),
+			(SELECT count(*) FROM votes)`,
+	).Scan(&totals.Users, &totals.Posts, &totals.Comments, &totals.Votes)
+	return totals, err
+}
+
+func (adh *AdminHandler) queryRecentPosts(limit int) ([]ContentItem, error) {
+	return adh.queryContent(
+		`SELECT p.id, 0, p.title, p.fk_user_id, u.name, p.created_at
+		 FROM posts p
+		 JOIN users u ON u.id = p.fk_user_id
+		 ORDER BY p.created_at DESC, p.id DESC
+		 LIMIT ?`,
+		limit,
+	)
+}
+
+func (adh *AdminHandler) queryRecentComments(limit int) ([]ContentItem, error) {
+	return adh.queryContent(
+		`SELECT c.fk_post_id, c.id, c.text, c.fk_user_id, u.name, c.created_at
+		 FROM comments c
+		 JOIN users u ON u.id = c.fk_user_id
+		 ORDER BY c.created_at DESC, c.id DESC
+		 LIMIT ?`,
+		limit,
+	)
+}
+
+func (adh *AdminHandler) queryContent(query string, args ...any) ([]ContentItem, error) {
+	rows, err := adh.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ContentItem
+	for rows.Next() {
+		var item ContentItem
+		if err := rows.Scan(
+			&item.PostID,
+			&item.CommentID,
+			&item.Text,
+			&item.UserID,
+			&item.UserName,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// queryActivity counts posts, comments, votes and the users who did any
+// of them per period, for the last count periods up to now.
+// Periods without activity are included with zeros.
+func (adh *AdminHandler) queryActivity(period Period, count int, now time.Time) ([]Activity, error) {
+	// both modifiers turn a date into the first day of its period,
+	// a week starts on monday
+	startModifiers := []any{"+0 days", "+0 days"}
+	first := now.UTC().AddDate(0, 0, 1-count)
+	if period == PeriodWeek {
+		startModifiers = []any{"weekday 0", "-6 days"}
+		first = now.UTC().AddDate(0, 0, -7*(count-1))
+		first = first.AddDate(0, 0, -(int(first.Weekday())+6)%7)
+	}
+	from := first.Format(time.DateOnly)
+
+	args := []any{}
+	for range 3 {
+		args = append(args, startModifiers...)
+		args = append(args, from)
+	}
+
+	rows, err := adh.db.Query(
+		`SELECT start,
+			sum(kind = 'post'), sum(kind = 'comment'), sum(kind = 'vote'),
+			count(DISTINCT fk_user_id)
+		FROM (
+			SELECT date(created_at, ?, ?) start, 'post' kind, fk_user_id FROM posts WHERE created_at >= ?
+			UNION ALL
+			SELECT date(created_at, ?, ?) start, 'comment' kind, fk_user_id FROM comments WHERE created_at >= ?
+			UNION ALL
+			SELECT date(created_at, ?, ?) start, 'vote' kind, fk_user_id FROM votes WHERE created_at >= ?
+		)
+		GROUP BY start`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byStart := map[string]Activity{}
+	for rows.Next() {
+		var activity Activity
+		if err := rows.Scan(
+			&activity.Start,
+			&activity.Posts,
+			&activity.Comments,
+			&activity.Votes,
+			&activity.ActiveUsers,
+		); err != nil {
+			return nil, err
+		}
+		byStart[activity.Start] = activity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	step := 1
+	if period == PeriodWeek {
+		step = 7
+	}
+	var activities []Activity
+	for i := range count {
+		start := first.AddDate(0, 0, i*step).Format(time.DateOnly)
+		activity := byStart[start]
+		activity.Start = start
+		activities = append(activities, activity)
+	}
+	return activities, nil
+}
+
+// deleteContentOfUser removes the posts, comments, votes and poll ballots
+// of the user. Everything attached to the posts goes with them, also
+// comments of other users. Replies to removed comments are kept,
+// they lose their parent instead.
+func (adh *AdminHandler) deleteContentOfUser(userID string) (posts int64, comments int64, err error) {
+	const postsOfUser = `SELECT id FROM posts WHERE fk_user_id = ?`
+	const commentsToDelete = `SELECT id FROM comments WHERE fk_user_id = ? OR fk_post_id IN (` + postsOfUser + `)`
+	const ballotsToDelete = `SELECT id FROM poll_ballots WHERE fk_user_id = ? OR fk_post_id IN (` + postsOfUser + `)`
+
+	statements := []string{
+		`DELETE FROM votes WHERE fk_user_id = ?
+			OR fk_post_id IN (` + postsOfUser + `)
+			OR fk_comment_id IN (` + commentsToDelete + `)`,
+		`DELETE FROM notifications WHERE fk_post_id IN (` + postsOfUser + `)
+			OR fk_comment_id IN (` + commentsToDelete + `)`,
+		`UPDATE comments SET fk_parent_id = NULL WHERE fk_parent_id IN (` + commentsToDelete + `)`,
+		`DELETE FROM poll_choices WHERE fk_ballot_id IN (` + ballotsToDelete + `)`,
+		`DELETE FROM poll_ballots WHERE id IN (` + ballotsToDelete + `)`,
+		`DELETE FROM poll_options WHERE fk_post_id IN (` + postsOfUser + `)`,
+		`DELETE FROM polls WHERE fk_post_id IN (` + postsOfUser + `)`,
+		`DELETE FROM post_tags WHERE fk_post_id IN (` + postsOfUser + `)`,
+		`DELETE FROM bookmarks WHERE fk_post_id IN (` + postsOfUser + `)`,
+		`DELETE FROM comments WHERE id IN (` + commentsToDelete + `)`,
+		`DELETE FROM posts WHERE fk_user_id = ?`,
+	}
+
+	tx, err := adh.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`SELECT (SELECT count(*) FROM (`+postsOfUser+`)), (SELECT count(*) FROM (`+commentsToDelete+`))`,
+		userID, userID, userID,
+	).Scan(&posts, &comments)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, statement := range statements {
+		// every placeholder is the user ID
+		args := make([]any, strings.Count(statement, "?"))
+		for i := range args {
+			args[i] = userID
+		}
+
+		if _, err := tx.Exec(statement, args...); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return posts, comments, tx.Commit()
+}
@@ -0,0 +1,22 @@
+package admin
+
+import (
+	"agora/src/audit"
+	"agora/src/db"
+	"agora/src/user"
+)
+
+// AdminHandler serves the pages under /admin
+type AdminHandler struct {
+	db *db.DB
+	uh *user.UserHandler
+	ah *audit.AuditHandler
+}
+
+func NewAdminHandler(db *db.DB, uh *user.UserHandler, ah *audit.AuditHandler) *AdminHandler {
+	return &AdminHandler{
+		db: db,
+		uh: uh,
+		ah: ah,
+	}
+}
@@ -0,0 +1,298 @@
+package admin
+
+import (
+	"agora/src/audit"
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/user"
+	"agora/src/x/date"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const recentContentSize = 10
+
+//go:embed admin-dashboard.html
+var adminDashboardTemplate string
+
+//go:embed admin-users.html
+var adminUsersTemplate string
+
+func (adh *AdminHandler) DashboardGETHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can see the dashboard", http.StatusForbidden)
+		return
+	}
+
+	period, periods := PeriodDay, 30
+	if r.URL.Query().Get("period") == string(PeriodWeek) {
+		period, periods = PeriodWeek, 12
+	}
+
+	totals, err := adh.queryTotals()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query totals", "err", err)
+		http.Error(w, "Could not retrieve statistics", http.StatusInternalServerError)
+		return
+	}
+
+	activities, err := adh.queryActivity(period, periods, time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query activity", "period", period, "err", err)
+		http.Error(w, "Could not retrieve statistics", http.StatusInternalServerError)
+		return
+	}
+	for i := range activities {
+		activities[i].Start = formatDay(activities[i].Start)
+	}
+
+	recentPosts, err := adh.queryRecentPosts(recentContentSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query recent posts", "err", err)
+	}
+	recentComments, err := adh.queryRecentComments(recentContentSize)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query recent comments", "err", err)
+	}
+	for _, items := range [][]ContentItem{recentPosts, recentComments} {
+		for i := range items {
+			items[i].CreatedAt = date.FormatDate(items[i].CreatedAt)
+			items[i].Text = shorten(items[i].Text)
+		}
+	}
+
+	render.RenderTemplate(
+		w,
+		"admin-dashboard.html",
+		&render.Page{
+			Title: "Admin",
+			Data: struct {
+				Totals         Totals
+				Period         Period
+				Charts         []Chart
+				RecentPosts    []ContentItem
+				RecentComments []ContentItem
+			}{
+				Totals: totals,
+				Period: period,
+				Charts: []Chart{
+					newChart("Posts", activities, func(a Activity) int { return a.Posts }),
+					newChart("Comments", activities, func(a Activity) int { return a.Comments }),
+					newChart("Votes", activities, func(a Activity) int { return a.Votes }),
+					newChart("Active users", activities, func(a Activity) int { return a.ActiveUsers }),
+				},
+				RecentPosts:    recentPosts,
+				RecentComments: recentComments,
+			},
+		},
+		r.Context(),
+		adminDashboardTemplate,
+	)
+}
+
+func (adh *AdminHandler) UsersGETHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can manage users", http.StatusForbidden)
+		return
+	}
+
+	users, err := adh.queryUsers()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query users", "err", err)
+		http.Error(w, "Could not retrieve users", http.StatusInternalServerError)
+		return
+	}
+	for i := range users {
+		users[i].CreatedAt = date.FormatDate(users[i].CreatedAt)
+		if users[i].LastLoginAt.Valid {
+			users[i].LastLoginAt.String = date.FormatDate(users[i].LastLoginAt.String)
+		}
+		if users[i].SuspendedUntil.Valid {
+			users[i].SuspendedUntil.String = date.FormatDate(users[i].SuspendedUntil.String)
+		}
+	}
+
+	render.RenderTemplate(
+		w,
+		"admin-users.html",
+		&render.Page{
+			Title: "Users",
+			Data: struct {
+				Users   []UserRow
+				Message string
+				Error   string
+			}{
+				Users:   users,
+				Message: usersMessage(r.URL.Query()),
+				Error:   usersErrors[r.URL.Query().Get("error")],
+			},
+		},
+		r.Context(),
+		adminUsersTemplate,
+	)
+}
+
+// UserDisablePOSTHandler suspends or reinstates a user,
+// depending on the disabled form value.
+// A suspension ends at the optional until form value
+func (adh *AdminHandler) UserDisablePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !admin.IsAdmin() {
+		http.Error(w, "Only admins can manage users", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	disabled := r.FormValue("disabled") == "true"
+	if disabled && userID == admin.ID {
+		redirectToUsersWithError(w, r, errSuspendSelf)
+		return
+	}
+
+	var until time.Time
+	if value := r.FormValue("until"); disabled && value != "" {
+		var err error
+		until, err = parseUntil(value)
+		if err != nil {
+			redirectToUsersWithError(w, r, errInvalidUntil)
+			return
+		}
+		if !until.After(time.Now()) {
+			redirectToUsersWithError(w, r, errPastUntil)
+			return
+		}
+	}
+
+	var err error
+	if disabled {
+		err = adh.uh.Suspend(userID, until)
+	} else {
+		err = adh.uh.Unsuspend(userID)
+	}
+	if err == user.ErrUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not suspend user", "userID", userID, "disabled", disabled, "err", err)
+		http.Error(w, "Could not update user", http.StatusInternalServerError)
+		return
+	}
+
+	action := audit.UserEnabled
+	details := ""
+	if disabled {
+		action = audit.UserDisabled
+		details = "until=further notice"
+		if !until.IsZero() {
+			details = "until=" + until.Format(date.DatetimeLocal)
+		}
+	}
+	adh.ah.Record(r, admin.ID, action, audit.UserTarget(userID), details)
+	slog.InfoContext(r.Context(), "changed user", "action", action, "userID", userID, "adminID", admin.ID, "details", details)
+
+	http.Redirect(w, r, "/admin/users#user-"+url.PathEscape(userID), http.StatusSeeOther)
+}
+
+// parseUntil accepts the value of a date
+// or a datetime-local input, a date ends the suspension
+// at the start of that day
+func parseUntil(value string) (time.Time, error) {
+	if until, err := time.ParseInLocation(date.DatetimeLocal, value, time.Local); err == nil {
+		return until, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+// UserDeleteContentPOSTHandler removes everything the user posted,
+// the account itself stays
+func (adh *AdminHandler) UserDeleteContentPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !admin.IsAdmin() {
+		http.Error(w, "Only admins can manage users", http.StatusForbidden)
+		return
+	}
+
+	userID := mux.Vars(r)["id"]
+	if !adh.uh.UserExists(userID) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	posts, comments, err := adh.deleteContentOfUser(userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not delete content of user", "userID", userID, "err", err)
+		http.Error(w, "Could not delete content", http.StatusInternalServerError)
+		return
+	}
+
+	details := fmt.Sprintf("posts=%d comments=%d", posts, comments)
+	adh.ah.Record(r, admin.ID, audit.UserContentDeleted, audit.UserTarget(userID), details)
+	slog.InfoContext(r.Context(), "deleted content of user", "userID", userID, "posts", posts, "comments", comments, "adminID", admin.ID)
+
+	target := fmt.Sprintf("/admin/users?message=%s&posts=%d&comments=%d", msgContentDeleted, posts, comments)
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// The users page shows messages by code, text from the URL
+// would end up in the page as it is
+const (
+	errSuspendSelf    = "suspend-self"
+	errInvalidUntil   = "invalid-until"
+	errPastUntil      = "past-until"
+	msgContentDeleted = "content-deleted"
+)
+
+var usersErrors = map[string]string{
+	errSuspendSelf:  "You cannot suspend yourself",
+	errInvalidUntil: "Invalid end of suspension, use a date like 2025-12-31",
+	errPastUntil:    "The end of the suspension must be in the future",
+}
+
+// usersMessage only takes the numbers from the URL
+func usersMessage(query url.Values) string {
+	if query.Get("message") != msgContentDeleted {
+		return ""
+	}
+	posts, _ := strconv.Atoi(query.Get("posts"))
+	comments, _ := strconv.Atoi(query.Get("comments"))
+	return fmt.Sprintf("Deleted %d posts and %d comments", posts, comments)
+}
+
+func redirectToUsersWithError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, "/admin/users?error="+code, http.StatusSeeOther)
+}
+
+func isAdmin(r *http.Request) bool {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	return ok && user.IsAdmin()
+}
+
+// formatDay turns 2006-01-02 into the short label of a chart bar
+func formatDay(day string) string {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return day
+	}
+	return t.Format("02.01.")
+}
+
+func shorten(text string) string {
+	const maxLength = 100
+	if len(text) > maxLength {
+		return text[:maxLength] + " …"
+	}
+	return text
+}
@@ -0,0 +1,91 @@
+package admin
+
+import "database/sql"
+
+type UserRow struct {
+	ID          string
+	Name        string
+	Email       string
+	Role        string
+	CreatedAt   string
+	LastLoginAt sql.NullString
+	Suspended   bool
+	// SuspendedUntil is only valid for suspensions with an end
+	SuspendedUntil sql.NullString
+
+	FNrOfPosts    int
+	FNrOfComments int
+	FNrOfVotes    int
+}
+
+type Totals struct {
+	Users    int
+	Posts    int
+	Comments int
+	Votes    int
+}
+
+// ContentItem is a post or a comment in the list of recent content
+type ContentItem struct {
+	PostID    int64
+	CommentID int64
+	// Text is the title of a post or the text of a comment
+	Text      string
+	UserID    string
+	UserName  string
+	CreatedAt string
+}
+
+// Period is the size of a bar in the activity charts
+type Period string
+
+const (
+	PeriodDay  Period = "day"
+	PeriodWeek Period = "week"
+)
+
+// Activity counts what happened in one period, Start is its first day
+type Activity struct {
+	Start       string
+	Posts       int
+	Comments    int
+	Votes       int
+	ActiveUsers int
+}
+
+type Chart struct {
+	Title string
+	Bars  []Bar
+	// From and To label the first and the last bar
+	From string
+	To   string
+}
+
+type Bar struct {
+	Label string
+	Count int
+	// Percent is the height relative to the highest bar of the chart
+	Percent int
+}
+
+// newChart scales the bars to the highest value of the chart
+func newChart(title string, activities []Activity, value func(Activity) int) Chart {
+	highest := 0
+	for _, activity := range activities {
+		highest = max(highest, value(activity))
+	}
+
+	chart := Chart{Title: title}
+	for _, activity := range activities {
+		bar := Bar{Label: activity.Start, Count: value(activity)}
+		if highest > 0 {
+			bar.Percent = bar.Count * 100 / highest
+		}
+		chart.Bars = append(chart.Bars, bar)
+	}
+	if len(activities) > 0 {
+		chart.From = activities[0].Start
+		chart.To = activities[len(activities)-1].Start
+	}
+	return chart
+}
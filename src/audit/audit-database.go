@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"database/sql"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// The triggers make the table append-only,
+// entries can neither be changed nor deleted.
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		fk_actor_id TEXT,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+		CONSTRAINT "fk_actor_id" FOREIGN KEY("fk_actor_id") REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+	BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit log is append-only');
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete
+	BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit log is append-only');
+	END;
+`
+
+func (ah *AuditHandler) CreateDBTable() error {
+	_, err := ah.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating audit_log table", "err", err)
+		return err
+	}
+	return nil
+}
+
+// Record appends an entry for an action of actorID done during request r,
+// actorID is empty if nobody is logged in, e.g. for failed logins.
+// The action already happened at this point, so a failure is only logged.
+// A nil handler records nothing.
+func (ah *AuditHandler) Record(r *http.Request, actorID string, action Action, target Target, details string) {
+	if ah == nil {
+		return
+	}
+
+	_, err := ah.db.Exec(
+		`INSERT INTO audit_log (action, fk_actor_id, target_type, target_id, details, ip, user_agent)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		action,
+		sql.NullString{String: actorID, Valid: actorID != ""},
+		target.Type,
+		target.ID,
+		details,
+		clientIP(r),
+		userAgent(r),
+	)
+	if err != nil {
+		slog.Error("could not write audit log", "action", action, "actorID", actorID, "target", target.Type+":"+target.ID, "err", err)
+	}
+}
+
+func userAgent(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return r.UserAgent()
+}
+
+// clientIP is the address of the direct peer, a proxy in front of
+// Agora would have to be trusted before X-Forwarded-For could be used
+func clientIP(r *http.Request) string {
+	// actions from the command line have no request
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// QueryEntries returns the entries matching filter, newest first.
+// A limit of 0 returns all of them.
+func (ah *AuditHandler) QueryEntries(filter Filter, limit int) ([]Entry, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := ah.db.Query(
+		`SELECT
+			a.id, a.action, coalesce(a.fk_actor_id, ''), a.target_type, a.target_id,
+			a.details, a.ip, a.user_agent, a.created_at,
+			coalesce(u.name, '')
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.fk_actor_id
+		WHERE (? = '' OR a.action = ?)
+		AND (? = '' OR a.fk_actor_id = ? OR u.name LIKE '%' || ? || '%')
+		AND (? = '' OR a.target_type = ?)
+		AND (? = '' OR a.target_id = ?)
+		AND (? = '' OR a.created_at >= date(?))
+		AND (? = '' OR a.created_at < date(?, '+1 day'))
+		ORDER BY a.id DESC
+		LIMIT ?`,
+		filter.Action, filter.Action,
+		filter.Actor, filter.Actor, filter.Actor,
+		filter.TargetType, filter.TargetType,
+		filter.TargetID, filter.TargetID,
+		filter.From, filter.From,
+		filter.To, filter.To,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.Action,
+			&entry.ActorID,
+			&entry.TargetType,
+			&entry.TargetID,
+			&entry.Details,
+			&entry.IP,
+			&entry.UserAgent,
+			&entry.CreatedAt,
+			&entry.FActorName,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
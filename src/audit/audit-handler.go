@@ -0,0 +1,16 @@
+package audit
+
+import (
+	"agora/src/db"
+)
+
+// AuditHandler keeps an append-only record of who did what
+type AuditHandler struct {
+	db *db.DB
+}
+
+func NewAuditHandler(db *db.DB) *AuditHandler {
+	return &AuditHandler{
+		db: db,
+	}
+}
@@ -0,0 +1,113 @@
+package audit
+
+import "strconv"
+
+type Action string
+
+const (
+	Login       Action = "user.login"
+	LoginFailed Action = "user.login_failed"
+	RoleChanged Action = "user.role_changed"
+
+	UserDisabled       Action = "user.disabled"
+	UserEnabled        Action = "user.enabled"
+	UserContentDeleted Action = "user.content_deleted"
+	UserProvisioned    Action = "user.provisioned"
+
+	PostDeleted  Action = "post.deleted"
+	PostPinned   Action = "post.pinned"
+	PostUnpinned Action = "post.unpinned"
+	PostLocked   Action = "post.locked"
+	PostUnlocked Action = "post.unlocked"
+
+	TagRenamed Action = "tag.renamed"
+	TagMerged  Action = "tag.merged"
+
+	FeedTokenCreated Action = "feed_token.created"
+	WebhookCreated   Action = "webhook.created"
+	WebhookToggled   Action = "webhook.toggled"
+	WebhookDeleted   Action = "webhook.deleted"
+
+	GroupProvisioned    Action = "group.provisioned"
+	GroupMembersChanged Action = "group.members_changed"
+	GroupDeleted        Action = "group.deleted"
+)
+
+// Actions in the order they are offered in the filter of the viewer
+var Actions = []Action{
+	Login,
+	LoginFailed,
+	RoleChanged,
+	UserDisabled,
+	UserEnabled,
+	UserContentDeleted,
+	UserProvisioned,
+	PostDeleted,
+	PostPinned,
+	PostUnpinned,
+	PostLocked,
+	PostUnlocked,
+	TagRenamed,
+	TagMerged,
+	FeedTokenCreated,
+	WebhookCreated,
+	WebhookToggled,
+	WebhookDeleted,
+	GroupProvisioned,
+	GroupMembersChanged,
+	GroupDeleted,
+}
+
+// Target is what an action was done to, e.g. a post
+type Target struct {
+	Type string
+	ID   string
+}
+
+func PostTarget(postID int) Target {
+	return Target{Type: "post", ID: strconv.Itoa(postID)}
+}
+
+func UserTarget(userID string) Target {
+	return Target{Type: "user", ID: userID}
+}
+
+func TagTarget(name string) Target {
+	return Target{Type: "tag", ID: name}
+}
+
+// GroupTarget is a group provisioned over SCIM
+func GroupTarget(groupID string) Target {
+	return Target{Type: "group", ID: groupID}
+}
+
+func WebhookTarget(webhookID int64) Target {
+	return Target{Type: "webhook", ID: strconv.FormatInt(webhookID, 10)}
+}
+
+type Entry struct {
+	ID         int64
+	Action     Action
+	ActorID    string
+	TargetType string
+	TargetID   string
+	Details    string
+	IP         string
+	UserAgent  string
+	CreatedAt  string
+
+	FActorName string
+}
+
+// Filter narrows down the entries in the viewer and the export,
+// empty fields match everything
+type Filter struct {
+	Action Action
+	// Actor matches the user ID or a part of the name
+	Actor      string
+	TargetType string
+	TargetID   string
+	// From and To are dates like 2006-01-02, both days are included
+	From string
+	To   string
+}
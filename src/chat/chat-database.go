@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS chat_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		body TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_chat_queue_due ON chat_queue(sent_at, next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS chat_summaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+func (ch *ChatHandler) CreateDBTable() error {
+	_, err := ch.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating chat tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (ch *ChatHandler) insertQueuedMessage(url string, body string) error {
+	_, err := ch.db.Exec(
+		`INSERT INTO chat_queue (url, body) VALUES (?, ?)`,
+		url,
+		body,
+	)
+	if err != nil {
+		slog.Error("error queueing chat message", "err", err)
+	}
+	return err
+}
+
+func (ch *ChatHandler) queryDueMessages() ([]queuedMessage, error) {
+	rows, err := ch.db.Query(
+		`SELECT id, url, body, attempts
+		 FROM chat_queue
+		 WHERE sent_at IS NULL
+		 AND attempts < ?
+		 AND next_attempt_at <= CURRENT_TIMESTAMP
+		 ORDER BY id
+		 LIMIT 50`,
+		maxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []queuedMessage
+	for rows.Next() {
+		var message queuedMessage
+		err := rows.Scan(
+			&message.ID,
+			&message.URL,
+			&message.Body,
+			&message.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func (ch *ChatHandler) markSent(id int64) error {
+	_, err := ch.db.Exec(
+		`UPDATE chat_queue SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = ?`,
+		id,
+	)
+	return err
+}
+
+func (ch *ChatHandler) markFailed(id int64, attempts int, retryIn time.Duration, lastError string) error {
+	_, err := ch.db.Exec(
+		`UPDATE chat_queue
+		 SET attempts = ?, last_error = ?, next_attempt_at = datetime('now', '+' || ? || ' seconds')
+		 WHERE id = ?`,
+		attempts,
+		lastError,
+		int(retryIn.Seconds()),
+		id,
+	)
+	return err
+}
+
+func (ch *ChatHandler) queryUserName(userID string) (string, error) {
+	var name string
+	err := ch.db.QueryRow(`SELECT name FROM users WHERE id = ?`, userID).Scan(&name)
+	return name, err
+}
+
+func (ch *ChatHandler) queryLastSummary() (time.Time, error) {
+	var sentAt time.Time
+	err := ch.db.QueryRow(`SELECT sent_at FROM chat_summaries ORDER BY sent_at DESC LIMIT 1`).Scan(&sentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return sentAt, err
+}
+
+func (ch *ChatHandler) insertSummary() error {
+	_, err := ch.db.Exec(`INSERT INTO chat_summaries DEFAULT VALUES`)
+	return err
+}
@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// teamsCard wraps the message in an adaptive card as expected by
+// Teams incoming webhooks and Power Automate "post to a channel" flows
+func teamsCard(message Message, baseURL string) ([]byte, error) {
+	body := []any{
+		map[string]any{
+			"type":   "TextBlock",
+			"text":   message.Heading,
+			"size":   "Medium",
+			"weight": "Bolder",
+			"wrap":   true,
+		},
+	}
+
+	for _, item := range message.Items {
+		blocks := []any{
+			map[string]any{
+				"type":   "TextBlock",
+				"text":   item.Title,
+				"weight": "Bolder",
+				"color":  "Accent",
+				"wrap":   true,
+			},
+		}
+		if item.Description != "" {
+			blocks = append(blocks, map[string]any{
+				"type":    "TextBlock",
+				"text":    item.Description,
+				"wrap":    true,
+				"spacing": "Small",
+			})
+		}
+		blocks = append(blocks, map[string]any{
+			"type":     "TextBlock",
+			"text":     item.Meta,
+			"isSubtle": true,
+			"size":     "Small",
+			"spacing":  "None",
+			"wrap":     true,
+		})
+
+		body = append(body, map[string]any{
+			"type":         "Container",
+			"items":        blocks,
+			"separator":    true,
+			"selectAction": map[string]any{"type": "Action.OpenUrl", "url": item.Link},
+		})
+	}
+
+	return json.Marshal(map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]any{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    body,
+					"actions": []any{
+						map[string]any{"type": "Action.OpenUrl", "title": "Open Agora", "url": baseURL},
+					},
+				},
+			},
+		},
+	})
+}
+
+// slackBlocks renders the message with Block Kit,
+// text is the fallback shown in notifications
+func slackBlocks(message Message) ([]byte, error) {
+	blocks := []any{
+		map[string]any{
+			"type": "header",
+			"text": map[string]any{"type": "plain_text", "text": message.Heading},
+		},
+	}
+
+	for _, item := range message.Items {
+		text := "*<" + item.Link + "|" + slackEscape(item.Title) + ">*"
+		if item.Description != "" {
+			text += "\n" + slackEscape(item.Description)
+		}
+
+		blocks = append(blocks,
+			map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": text},
+			},
+			map[string]any{
+				"type": "context",
+				"elements": []any{
+					map[string]any{"type": "mrkdwn", "text": slackEscape(item.Meta)},
+				},
+			},
+		)
+	}
+
+	return json.Marshal(map[string]any{
+		"text":   message.Heading,
+		"blocks": blocks,
+	})
+}
+
+// slackEscape escapes the characters slack uses for links and mentions
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
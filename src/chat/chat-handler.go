@@ -0,0 +1,151 @@
+package chat
+
+import (
+	"agora/src/db"
+	"agora/src/event"
+	"agora/src/post"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const pollInterval = 30 * time.Second
+const maxAttempts = 6
+const requestTimeout = 10 * time.Second
+
+// ChatHandler posts new posts and a daily summary of the top posts
+// to Microsoft Teams and Slack channels through their incoming webhooks.
+// Messages are queued in the database and retried with backoff.
+type ChatHandler struct {
+	db     *db.DB
+	config Config
+	ph     *post.PostHandler
+	client *http.Client
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func NewChatHandler(db *db.DB, config Config, ph *post.PostHandler, bus *event.Bus) *ChatHandler {
+	ch := &ChatHandler{
+		db:     db,
+		config: config,
+		ph:     ph,
+		client: &http.Client{Timeout: requestTimeout},
+		stop:   make(chan struct{}),
+	}
+	bus.Subscribe(event.PostCreated, ch.onPostCreated)
+	return ch
+}
+
+// Enqueue renders the message for every configured channel
+func (ch *ChatHandler) Enqueue(message Message) error {
+	teamsBody, err := teamsCard(message, ch.config.BaseURL)
+	if err != nil {
+		return err
+	}
+	slackBody, err := slackBlocks(message)
+	if err != nil {
+		return err
+	}
+
+	for _, url := range ch.config.TeamsURLs {
+		if err := ch.insertQueuedMessage(url, string(teamsBody)); err != nil {
+			return err
+		}
+	}
+	for _, url := range ch.config.SlackURLs {
+		if err := ch.insertQueuedMessage(url, string(slackBody)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ch *ChatHandler) Start() {
+	if !ch.config.Enabled() {
+		slog.Info("chat notifier is disabled, no Teams or Slack webhook is configured")
+		return
+	}
+
+	ch.stopped.Add(1)
+	go func() {
+		defer ch.stopped.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			ch.sendSummaryIfDue(time.Now())
+			ch.sendDueMessages()
+
+			select {
+			case <-ticker.C:
+			case <-ch.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the message currently being sent, queued messages
+// stay in the database and are sent after the next start
+func (ch *ChatHandler) Stop() {
+	if !ch.config.Enabled() {
+		return
+	}
+	close(ch.stop)
+	ch.stopped.Wait()
+}
+
+func (ch *ChatHandler) sendDueMessages() {
+	messages, err := ch.queryDueMessages()
+	if err != nil {
+		slog.Error("could not query chat queue", "err", err)
+		return
+	}
+
+	for _, message := range messages {
+		err := ch.send(message)
+		if err == nil {
+			if err := ch.markSent(message.ID); err != nil {
+				slog.Error("could not mark chat message as sent", "id", message.ID, "err", err)
+			}
+			continue
+		}
+
+		attempts := message.Attempts + 1
+		slog.Warn("could not send chat message", "id", message.ID, "attempt", attempts, "err", err)
+		if err := ch.markFailed(message.ID, attempts, backoff(attempts), err.Error()); err != nil {
+			slog.Error("could not update chat queue", "id", message.ID, "err", err)
+		}
+	}
+}
+
+func (ch *ChatHandler) send(message queuedMessage) error {
+	response, err := ch.client.Post(message.URL, "application/json", bytes.NewReader([]byte(message.Body)))
+	if urlErr, ok := err.(*url.Error); ok {
+		// the webhook url contains the secret of the channel, keep it out of the logs
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
+
+// backoff doubles the wait time with every attempt, starting at one minute
+func backoff(attempts int) time.Duration {
+	return time.Minute * time.Duration(1<<(attempts-1))
+}
@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"agora/src/event"
+	"agora/src/post"
+	"fmt"
+	"html"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+const summarySize = 5
+const descriptionLength = 300
+
+func (ch *ChatHandler) onPostCreated(e event.Event) {
+	if !ch.config.Enabled() || !ch.config.NewPosts {
+		return
+	}
+
+	payload, ok := e.Payload.(event.PostCreatedPayload)
+	if !ok {
+		slog.Error("unexpected payload", "topic", e.Topic, "payload", e.Payload)
+		return
+	}
+
+	author, err := ch.queryUserName(payload.UserID)
+	if err != nil {
+		slog.Error("could not query post author", "userID", payload.UserID, "err", err)
+	}
+
+	err = ch.Enqueue(Message{
+		Heading: "New post on Agora",
+		Items: []Item{{
+			Title:       plain(payload.Title),
+			Link:        fmt.Sprintf("%s/posts/%d", ch.config.BaseURL, payload.PostID),
+			Description: truncate(plain(payload.Description), descriptionLength),
+			Meta:        "by " + author,
+		}},
+	})
+	if err != nil {
+		slog.Error("could not queue chat message for new post", "postID", payload.PostID, "err", err)
+	}
+}
+
+// sendSummaryIfDue queues the daily summary once the configured
+// hour is reached and no summary went out today
+func (ch *ChatHandler) sendSummaryIfDue(now time.Time) {
+	if ch.config.SummaryHour < 0 || now.Hour() < ch.config.SummaryHour {
+		return
+	}
+
+	lastSummary, err := ch.queryLastSummary()
+	if err != nil {
+		slog.Error("could not query last chat summary", "err", err)
+		return
+	}
+	if now.Sub(lastSummary) < 20*time.Hour {
+		return
+	}
+
+	if err := ch.insertSummary(); err != nil {
+		slog.Error("could not record chat summary", "err", err)
+		return
+	}
+
+	if err := ch.SendSummary(); err != nil {
+		slog.Error("could not send chat summary", "err", err)
+	}
+}
+
+// SendSummary queues the posts with the highest rank
+func (ch *ChatHandler) SendSummary() error {
+	records, err := ch.ph.QueryAllPostsForTheList("", post.PostListFilter{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		slog.Info("no posts yet, skipping chat summary")
+		return nil
+	}
+
+	var items []Item
+	for _, record := range records[:min(summarySize, len(records))] {
+		items = append(items, Item{
+			Title: plain(record.Title),
+			Link:  fmt.Sprintf("%s/posts/%d", ch.config.BaseURL, record.ID),
+			Meta:  fmt.Sprintf("%d votes · %d comments · by %s", record.FNrOfVotes, record.FNrOfComments, record.FUserName),
+		})
+	}
+
+	slog.Info("queued chat summary", "posts", len(items))
+	return ch.Enqueue(Message{
+		Heading: fmt.Sprintf("Top %d on Agora today", len(items)),
+		Items:   items,
+	})
+}
+
+// plain reverts the html escaping done by sanitize on user input
+func plain(text string) string {
+	return html.UnescapeString(text)
+}
+
+func truncate(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	return string([]rune(text)[:length]) + "…"
+}
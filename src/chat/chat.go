@@ -0,0 +1,41 @@
+package chat
+
+type Config struct {
+	// TeamsURLs and SlackURLs are incoming webhooks of the channels
+	// to post to, the notifier is disabled if both are empty
+	TeamsURLs []string
+	SlackURLs []string
+	// NewPosts announces every new post
+	NewPosts bool
+	// SummaryHour is the hour of the day the top posts are posted,
+	// a negative hour disables the daily summary
+	SummaryHour int
+	// BaseURL is used to build absolute links in the messages
+	BaseURL string
+}
+
+func (c Config) Enabled() bool {
+	return len(c.TeamsURLs) > 0 || len(c.SlackURLs) > 0
+}
+
+// Message is rendered as an adaptive card for Teams
+// and as blocks for Slack
+type Message struct {
+	Heading string
+	Items   []Item
+}
+
+type Item struct {
+	Title       string
+	Link        string
+	Description string
+	// Meta is a short line like the author and the number of votes
+	Meta string
+}
+
+type queuedMessage struct {
+	ID       int64
+	URL      string
+	Body     string
+	Attempts int
+}
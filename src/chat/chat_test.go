@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"agora/src/audit"
+	"agora/src/db/dbtest"
+	"agora/src/event"
+	"agora/src/post"
+	"agora/src/post/bookmark"
+	"agora/src/post/comment"
+	"agora/src/post/poll"
+	"agora/src/post/tag"
+	"agora/src/user"
+	"agora/src/vote"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestChatHandler wires the chat handler to a post handler,
+// the summary lists real posts
+func newTestChatHandler(t *testing.T, config Config) (*ChatHandler, *post.PostHandler) {
+	t.Helper()
+
+	database := dbtest.Open(t)
+	bus := event.NewBus()
+	uh := user.NewUserHandler(database, nil, nil, nil, nil)
+	ah := audit.NewAuditHandler(database)
+	cmh := comment.NewCommentHandler(database, bus)
+	th := tag.NewTagHandler(database, ah)
+	bh := bookmark.NewBookmarkHandler(database)
+	plh := poll.NewPollHandler(database)
+	ph := post.NewPostHandler(database, cmh, th, bh, plh, ah, bus, 0)
+	vh := vote.NewVoteHandler(database, ph, bus)
+	ch := NewChatHandler(database, config, ph, bus)
+	dbtest.Migrate(t,
+		uh.CreateDBTable, ah.CreateDBTable, cmh.CreateDBTable, th.CreateDBTable, bh.CreateDBTable,
+		plh.CreateDBTable, ph.CreateDBTable, vh.CreateDBTable, ch.CreateDBTable,
+	)
+
+	if _, err := uh.AddUser("u1", "Alice", "alice@example.com"); err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	return ch, ph
+}
+
+func insertPost(t *testing.T, ph *post.PostHandler, title string) {
+	t.Helper()
+	_, err := ph.InsertNewPost(post.PostNewRecord{Title: title, Description: "text", UserID: "u1", Type: post.TypeAsk})
+	if err != nil {
+		t.Fatalf("could not insert post: %v", err)
+	}
+}
+
+func countSummaries(t *testing.T, ch *ChatHandler) int {
+	t.Helper()
+	var count int
+	if err := ch.db.QueryRow(`SELECT count(*) FROM chat_summaries`).Scan(&count); err != nil {
+		t.Fatalf("could not count summaries: %v", err)
+	}
+	return count
+}
+
+// today is the given time of day on the current date
+func today(hour int, minute int) time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.Local)
+}
+
+func TestSummaryWaitsForTheConfiguredHour(t *testing.T) {
+	ch, ph := newTestChatHandler(t, Config{SlackURLs: []string{"http://chat.test/hook"}, SummaryHour: 9})
+	insertPost(t, ph, "Go &amp; SQLite")
+
+	ch.sendSummaryIfDue(today(8, 59))
+	if count := countSummaries(t, ch); count != 0 {
+		t.Fatalf("summary should wait for 9 o'clock, got %d", count)
+	}
+
+	ch.sendSummaryIfDue(today(9, 0))
+	if count := countSummaries(t, ch); count != 1 {
+		t.Fatalf("summary should be sent at 9 o'clock, got %d", count)
+	}
+
+	queued, err := ch.queryDueMessages()
+	if err != nil {
+		t.Fatalf("could not query queue: %v", err)
+	}
+	if len(queued) != 1 {
+		t.Fatalf("expected the summary in the queue, got %d messages", len(queued))
+	}
+	if body := queued[0].Body; !strings.Contains(body, `"text":"Top 1 on Agora today"`) || !strings.Contains(body, "Go \\u0026amp; SQLite") {
+		t.Errorf("summary should list the post escaped for slack: %s", body)
+	}
+}
+
+func TestSummaryIsSentOnceADay(t *testing.T) {
+	// hour 0 is always reached, only the time since the last summary counts
+	ch, ph := newTestChatHandler(t, Config{TeamsURLs: []string{"http://chat.test/hook"}, SummaryHour: 0})
+	insertPost(t, ph, "First post")
+
+	now := time.Now()
+	for _, test := range []struct {
+		at   time.Time
+		want int
+	}{
+		{now, 1},
+		{now.Add(time.Hour), 1},
+		{now.Add(19 * time.Hour), 1},
+		{now.Add(21 * time.Hour), 2},
+	} {
+		ch.sendSummaryIfDue(test.at)
+		if count := countSummaries(t, ch); count != test.want {
+			t.Errorf("%v after the first summary: expected %d summaries, got %d", test.at.Sub(now), test.want, count)
+		}
+	}
+}
+
+func TestNegativeSummaryHourTurnsTheSummaryOff(t *testing.T) {
+	ch, ph := newTestChatHandler(t, Config{SlackURLs: []string{"http://chat.test/hook"}, SummaryHour: -1})
+	insertPost(t, ph, "First post")
+
+	ch.sendSummaryIfDue(today(23, 59))
+
+	if count := countSummaries(t, ch); count != 0 {
+		t.Errorf("summary should be off, got %d", count)
+	}
+}
+
+func TestNon2xxIsRetriedWithBackoff(t *testing.T) {
+	// the first call fails, every later one succeeds
+	bodies := make(chan string, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := len(bodies) == 0
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ch, _ := newTestChatHandler(t, Config{SlackURLs: []string{server.URL}, SummaryHour: -1})
+	if err := ch.Enqueue(Message{Heading: "New post on Agora"}); err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+
+	var attempts int
+	var lastError string
+	var retryIn int
+	queryQueue := func() {
+		t.Helper()
+		err := ch.db.QueryRow(
+			`SELECT attempts, coalesce(last_error, ''), strftime('%s', next_attempt_at) - strftime('%s', 'now')
+			 FROM chat_queue WHERE sent_at IS NULL`,
+		).Scan(&attempts, &lastError, &retryIn)
+		if err != nil {
+			t.Fatalf("could not query queue: %v", err)
+		}
+	}
+
+	ch.sendDueMessages()
+	queryQueue()
+	if attempts != 1 || lastError != "unexpected status 503 Service Unavailable" {
+		t.Fatalf("failure not recorded: attempts=%d lastError=%q", attempts, lastError)
+	}
+	if retryIn < 55 || retryIn > 60 {
+		t.Errorf("first retry should be in a minute, got %ds", retryIn)
+	}
+
+	ch.sendDueMessages()
+	if len(bodies) != 1 {
+		t.Fatalf("message was resent before its backoff passed")
+	}
+
+	if _, err := ch.db.Exec(`UPDATE chat_queue SET next_attempt_at = CURRENT_TIMESTAMP`); err != nil {
+		t.Fatalf("could not skip the backoff: %v", err)
+	}
+	ch.sendDueMessages()
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected one retry, got %d requests", len(bodies))
+	}
+	if first, retry := <-bodies, <-bodies; first != retry {
+		t.Errorf("the retry should send the same payload, got %s and %s", first, retry)
+	}
+
+	var sent bool
+	err := ch.db.QueryRow(`SELECT sent_at IS NOT NULL AND attempts = 2 FROM chat_queue`).Scan(&sent)
+	if err != nil {
+		t.Fatalf("could not query queue: %v", err)
+	}
+	if !sent {
+		t.Error("message should be sent on the second attempt")
+	}
+}
+
+func TestSendKeepsWebhookURLOutOfErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	webhookURL := server.URL + "/webhook/secret-token"
+	server.Close()
+
+	ch := &ChatHandler{client: &http.Client{Timeout: requestTimeout}}
+	err := ch.send(queuedMessage{URL: webhookURL, Body: "{}"})
+	if err == nil {
+		t.Fatal("expected an error for a closed server")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("error contains the webhook url: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"agora/src/audit"
+	"agora/src/config"
+	"agora/src/db"
+	"agora/src/user"
+	"agora/src/x/date"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const adminUsage = `admin <action> [flags] [arguments]
+
+Actions:
+  list                    list admins, moderators and suspended users
+  role <email> <role>     set the role to user, moderator or admin
+  suspend <email>         suspend the user, --until ends the suspension
+  unsuspend <email>       lift the suspension`
+
+func admin(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: agora %s\n", adminUsage)
+		return 2
+	}
+	action, args := args[0], args[1:]
+
+	c := newCommand("admin "+action, adminUsage)
+	until := c.flags.String("until", "", "end of a suspension, e.g. 2025-12-31 or 2025-12-31T18:00")
+	cfg, err := c.parse(args)
+	if err != nil {
+		return exitCode(err)
+	}
+	arguments := c.args
+
+	need := map[string]int{"list": 0, "role": 2, "suspend": 1, "unsuspend": 1}
+	count, known := need[action]
+	if !known || len(arguments) != count {
+		c.flags.Usage()
+		return 2
+	}
+
+	return exitCode(withDB(cfg, func(database *db.DB) error {
+		uh, ah, err := userHandlers(cfg, database)
+		if err != nil {
+			return err
+		}
+
+		if action == "list" {
+			return listPrivileged(uh)
+		}
+
+		u, err := uh.QueryUserByEmail(arguments[0])
+		if err == user.ErrUserNotFound {
+			return fmt.Errorf("no user with the email %s, users are added at their first login", arguments[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		switch action {
+		case "role":
+			role := arguments[1]
+			if err := uh.SetRole(u.ID, role); err != nil {
+				return fmt.Errorf("could not set role '%s': %w", role, err)
+			}
+			ah.Record(nil, "", audit.RoleChanged, audit.UserTarget(u.ID), "role="+role+" set on the command line")
+			fmt.Printf("%s is now %s\n", u.Email, role)
+
+		case "suspend":
+			var end time.Time
+			if *until != "" {
+				end, err = parseUntil(*until)
+				if err != nil || !end.After(time.Now()) {
+					return fmt.Errorf("--until must be a future date like 2025-12-31")
+				}
+			}
+			if err := uh.Suspend(u.ID, end); err != nil {
+				return err
+			}
+			details := "until=further notice"
+			if !end.IsZero() {
+				details = "until=" + end.Format(date.DatetimeLocal)
+			}
+			ah.Record(nil, "", audit.UserDisabled, audit.UserTarget(u.ID), details+" set on the command line")
+			fmt.Printf("%s is suspended %s\n", u.Email, details)
+
+		case "unsuspend":
+			if err := uh.Unsuspend(u.ID); err != nil {
+				return err
+			}
+			ah.Record(nil, "", audit.UserEnabled, audit.UserTarget(u.ID), "set on the command line")
+			fmt.Printf("%s is not suspended anymore\n", u.Email)
+		}
+		return nil
+	}))
+}
+
+func userHandlers(cfg config.Config, database *db.DB) (*user.UserHandler, *audit.AuditHandler, error) {
+	uh := user.NewUserHandler(database, cfg.AdminEmails, cfg.ModeratorEmails, cfg.AdminGroups, cfg.ModeratorGroups)
+	if err := uh.CreateDBTable(); err != nil {
+		return nil, nil, err
+	}
+	ah := audit.NewAuditHandler(database)
+	if err := ah.CreateDBTable(); err != nil {
+		return nil, nil, err
+	}
+	return uh, ah, nil
+}
+
+func listPrivileged(uh *user.UserHandler) error {
+	users, err := uh.RetrieveUserMap()
+	if err != nil {
+		return err
+	}
+
+	var listed []user.User
+	suspended := map[string]bool{}
+	for _, u := range users {
+		suspension, err := uh.QuerySuspension(u.ID)
+		if err != nil {
+			return err
+		}
+		suspended[u.ID] = suspension.Suspended
+		if u.Role != user.RoleUser || suspension.Suspended {
+			listed = append(listed, u)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Email < listed[j].Email })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EMAIL\tNAME\tROLE\tSUSPENDED")
+	for _, u := range listed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\n", u.Email, u.Name, u.Role, suspended[u.ID])
+	}
+	return tw.Flush()
+}
+
+// parseUntil accepts a date or a date with time in local time
+func parseUntil(value string) (time.Time, error) {
+	if until, err := time.ParseInLocation(date.DatetimeLocal, value, time.Local); err == nil {
+		return until, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"agora/src/config"
+	"agora/src/db"
+	"agora/src/log"
+	"agora/src/server"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+const usage = `Usage: agora <command> [flags]
+
+Commands:
+  serve     run the web server, the default without a command
+  migrate   create missing tables and columns
+  admin     manage roles and suspensions of users
+  export    write all data as JSON
+  import    read an export into an empty database
+
+Settings are read from a config file (.env if it exists), the environment
+and flags, each overriding the one before. Run 'agora <command> -h'
+for the flags, add --print-config to see the effective settings.
+`
+
+// Run executes the command and returns the exit code
+func Run(args []string) int {
+	if len(args) == 0 {
+		return serve(nil)
+	}
+
+	// older versions took the port and the database path as arguments
+	if _, err := strconv.Atoi(args[0]); err == nil {
+		slog.Warn("positional port and database path are deprecated, use agora serve --port --db-path")
+		legacy := []string{"--port", args[0]}
+		if len(args) > 1 {
+			legacy = append(legacy, "--db-path", args[1])
+		}
+		return serve(legacy)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return serve(args)
+	case "migrate":
+		return migrate(args)
+	case "admin":
+		return admin(args)
+	case "export":
+		return export(args)
+	case "import":
+		return importData(args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", command, usage)
+	return 2
+}
+
+// command is a flag set with all settings,
+// commands add their own flags before parsing
+type command struct {
+	flags       *flag.FlagSet
+	loader      *config.Loader
+	printConfig bool
+	// args are the arguments left after the flags
+	args []string
+}
+
+func newCommand(name string, usage string) *command {
+	c := &command{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "Usage: agora %s\n\nFlags:\n", usage)
+		c.flags.PrintDefaults()
+	}
+	c.loader = config.NewLoader(c.flags)
+	c.flags.BoolVar(&c.printConfig, "print-config", false, "print the effective settings, secrets redacted, and exit")
+	return c
+}
+
+// errExit ends a command early with the exit code,
+// e.g. after the help or the config was printed
+type errExit int
+
+func (e errExit) Error() string {
+	return "exit " + strconv.Itoa(int(e))
+}
+
+// parse reads the flags, which may come before and after the arguments
+func (c *command) parse(args []string) (config.Config, error) {
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return config.Config{}, errExit(0)
+			}
+			return config.Config{}, errExit(2)
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		c.args = append(c.args, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := c.loader.Load()
+	if c.printConfig {
+		c.loader.Print(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\ninvalid config:\n%s\n", err)
+			return config.Config{}, errExit(1)
+		}
+		return config.Config{}, errExit(0)
+	}
+	if err != nil {
+		return config.Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	options, _ := cfg.LogOptions()
+	log.Setup(os.Stderr, options)
+	return cfg, nil
+}
+
+// exitCode prints the error of a command
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exit errExit
+	if errors.As(err, &exit) {
+		return int(exit)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", err)
+	return 1
+}
+
+func serve(args []string) int {
+	c := newCommand("serve", "serve [flags]")
+	cfg, err := c.parse(args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if err := cfg.ValidateLogin(); err != nil {
+		return exitCode(fmt.Errorf("invalid config:\n%w", err))
+	}
+
+	fmt.Fprintln(os.Stdout, "Effective config:")
+	c.loader.Print(os.Stdout)
+
+	srv := server.NewServer(cfg)
+	srv.Start()
+	srv.WaitTilRunning()
+	return 0
+}
+
+func migrate(args []string) int {
+	c := newCommand("migrate", "migrate [flags]")
+	cfg, err := c.parse(args)
+	if err != nil {
+		return exitCode(err)
+	}
+
+	return exitCode(withDB(cfg, func(database *db.DB) error {
+		if err := server.Migrate(cfg, database); err != nil {
+			return err
+		}
+		slog.Info("migrated database", "dbpath", cfg.DBPath)
+		return nil
+	}))
+}
+
+func export(args []string) int {
+	c := newCommand("export", "export [--out file] [flags]")
+	out := c.flags.String("out", "", "file to write to, stdout without one")
+	cfg, err := c.parse(args)
+	if err != nil {
+		return exitCode(err)
+	}
+
+	return exitCode(withDB(cfg, func(database *db.DB) error {
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+		return database.Export(w)
+	}))
+}
+
+func importData(args []string) int {
+	c := newCommand("import", "import [flags] <file>, - reads stdin")
+	cfg, err := c.parse(args)
+	if err != nil {
+		return exitCode(err)
+	}
+	if len(c.args) != 1 {
+		c.flags.Usage()
+		return 2
+	}
+
+	return exitCode(withDB(cfg, func(database *db.DB) error {
+		var r io.Reader = os.Stdin
+		if name := c.args[0]; name != "-" {
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+
+		// the tables have to exist before rows can go in
+		if err := server.Migrate(cfg, database); err != nil {
+			return err
+		}
+		rows, err := database.Import(r)
+		if err != nil {
+			return err
+		}
+		slog.Info("imported data", "rows", rows, "dbpath", cfg.DBPath)
+		return nil
+	}))
+}
+
+func withDB(cfg config.Config, run func(database *db.DB) error) error {
+	database, err := db.Open(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("could not open database '%s': %w", cfg.DBPath, err)
+	}
+	defer database.Close()
+	return run(database)
+}
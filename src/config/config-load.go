@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+)
+
+// defaultFile is read if it exists and no other file is given
+const defaultFile = ".env"
+
+// Loader adds the settings as flags to the flag set
+// of a command and layers them after parsing
+type Loader struct {
+	config   *Config
+	settings []setting
+	file     string
+	flags    map[string]string
+	// sources tells where the value of each key came from
+	sources map[string]string
+}
+
+func NewLoader(flags *flag.FlagSet) *Loader {
+	config := &Config{}
+	l := &Loader{
+		config:   config,
+		settings: config.settings(),
+		flags:    map[string]string{},
+		sources:  map[string]string{},
+	}
+
+	flags.StringVar(&l.file, "config", "", "config file with KEY=value lines, defaults to "+defaultFile+" if it exists")
+	for _, s := range l.settings {
+		key := s.key
+		flags.Func(s.flagName(), s.usage+" ("+key+")", func(value string) error {
+			l.flags[key] = value
+			return nil
+		})
+	}
+	return l
+}
+
+// Load layers the config file, the environment and the flags
+// over the defaults and validates the result.
+// Call it after the flag set is parsed
+func (l *Loader) Load() (Config, error) {
+	var problems []error
+
+	fileValues, file, err := l.readFile()
+	if err != nil {
+		return Config{}, err
+	}
+
+	for _, s := range l.settings {
+		l.sources[s.key] = "default"
+		layers := []struct {
+			source string
+			value  string
+			found  bool
+		}{
+			{file, fileValues[s.key], fileValues[s.key] != ""},
+			{"environment", os.Getenv(s.key), os.Getenv(s.key) != ""},
+			{"flag --" + s.flagName(), l.flags[s.key], hasKey(l.flags, s.key)},
+		}
+		for _, layer := range layers {
+			if !layer.found {
+				continue
+			}
+			if err := s.set(layer.value); err != nil {
+				problems = append(problems, fmt.Errorf("%s from %s: invalid value '%s'", s.key, layer.source, layer.value))
+				continue
+			}
+			l.sources[s.key] = layer.source
+		}
+	}
+
+	if err := l.config.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return *l.config, errors.Join(problems...)
+}
+
+// readFile returns no values if the default file does not exist,
+// a file given with --config has to exist
+func (l *Loader) readFile() (map[string]string, string, error) {
+	file := l.file
+	if file == "" {
+		file = defaultFile
+	}
+
+	values, err := godotenv.Read(file)
+	if errors.Is(err, fs.ErrNotExist) && l.file == "" {
+		return map[string]string{}, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read config file '%s': %w", file, err)
+	}
+	return values, "file " + file, nil
+}
+
+// Print writes the effective config, secrets are redacted
+func (l *Loader) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range l.settings {
+		value := s.get()
+		if s.secret && value != "" {
+			value = "<redacted>"
+		}
+		fmt.Fprintf(tw, "%s=%s\t# %s\n", s.key, value, l.sources[s.key])
+	}
+	tw.Flush()
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// setting is one field of the config,
+// set parses the value of a layer into the field
+type setting struct {
+	key    string
+	usage  string
+	secret bool
+	set    func(value string) error
+	get    func() string
+}
+
+func secret(s setting) setting {
+	s.secret = true
+	return s
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.key), "_", "-")
+}
+
+func stringSetting(field *string, key string, fallback string, usage string) setting {
+	*field = fallback
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(value string) error {
+			*field = value
+			return nil
+		},
+		get: func() string { return *field },
+	}
+}
+
+func intSetting(field *int, key string, fallback int, usage string) setting {
+	*field = fallback
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(value string) error {
+			number, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return err
+			}
+			*field = number
+			return nil
+		},
+		get: func() string { return strconv.Itoa(*field) },
+	}
+}
+
+func boolSetting(field *bool, key string, fallback bool, usage string) setting {
+	*field = fallback
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(value string) error {
+			b, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return err
+			}
+			*field = b
+			return nil
+		},
+		get: func() string { return strconv.FormatBool(*field) },
+	}
+}
+
+// listSetting reads comma separated values
+func listSetting(field *[]string, key string, usage string) setting {
+	*field = nil
+	return setting{
+		key:   key,
+		usage: usage,
+		set: func(value string) error {
+			var values []string
+			for _, v := range strings.Split(value, ",") {
+				v = strings.TrimSpace(v)
+				if v != "" {
+					values = append(values, v)
+				}
+			}
+			*field = values
+			return nil
+		},
+		get: func() string { return strings.Join(*field, ",") },
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"agora/src/log"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Config holds every setting of Agora. Settings are layered,
+// each layer overrides the one before:
+// defaults, the config file, environment variables and flags
+type Config struct {
+	Host   string
+	Port   string
+	DBPath string
+	// ShutdownTimeout is how long running requests
+	// may take to finish at shutdown, in seconds
+	ShutdownTimeout int
+
+	AzureTenantID     string
+	AzureClientID     string
+	AzureClientSecret string
+	AzureRedirectURL  string
+	JWTSecret         string
+	BaseURL           string
+
+	RepostAfterDays int
+	AdminEmails     []string
+	ModeratorEmails []string
+	// AdminGroups and ModeratorGroups are Entra group IDs
+	// whose members get the role at login
+	AdminGroups         []string
+	ModeratorGroups     []string
+	AllowedEmailDomains []string
+	AllowedTenantIDs    []string
+	AllowedGroups       []string
+
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	SMTPFrom      string
+	DigestWeekday int
+	DigestHour    int
+
+	TeamsWebhookURLs []string
+	SlackWebhookURLs []string
+	ChatNewPosts     bool
+	ChatSummaryHour  int
+
+	// ScimSecret is the bearer token of the SCIM endpoints,
+	// they are off without one
+	ScimSecret string
+
+	// MetricsAddress serves /metrics on a separate listener, e.g. localhost:9100,
+	// without one /metrics is served next to the app if MetricsToken is set
+	MetricsAddress string
+	MetricsToken   string
+
+	// LogFormat is text or json, LogLevels override
+	// LogLevel per package, e.g. post=debug
+	LogFormat string
+	LogLevel  string
+	LogLevels []string
+
+	// CookieSecure and CookieSameSite apply to the login cookie
+	CookieSecure   bool
+	CookieSameSite string
+}
+
+// settings maps every field to its key, the key is the name
+// in the config file and the environment, flags are the key
+// in lower case with dashes, e.g. SMTP_HOST is --smtp-host
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting(&c.Host, "HOST", "localhost", "host to bind to, 0.0.0.0 for all interfaces"),
+		stringSetting(&c.Port, "PORT", "54324", "port to listen on"),
+		stringSetting(&c.DBPath, "DB_PATH", "tmp/agora_local.db", "path of the SQLite database"),
+		intSetting(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT", 15, "seconds running requests may take to finish at shutdown"),
+
+		stringSetting(&c.AzureTenantID, "AZURE_TENANT_ID", "", "Entra tenant used for login"),
+		stringSetting(&c.AzureClientID, "AZURE_CLIENT_ID", "", "client ID of the Entra app"),
+		secret(stringSetting(&c.AzureClientSecret, "AZURE_CLIENT_SECRET", "", "client secret of the Entra app")),
+		stringSetting(&c.AzureRedirectURL, "AZURE_REDIRECT_URL", "", "login callback URL registered in Entra"),
+		secret(stringSetting(&c.JWTSecret, "JWT_SECRET", "", "secret to sign login cookies with")),
+		stringSetting(&c.BaseURL, "BASE_URL", "", "public URL for absolute links, defaults to the listen address"),
+
+		intSetting(&c.RepostAfterDays, "REPOST_AFTER_DAYS", 0, "days after which a URL can be posted again, 0 never"),
+		listSetting(&c.AdminEmails, "ADMIN_EMAILS", "emails granted the admin role at login"),
+		listSetting(&c.ModeratorEmails, "MODERATOR_EMAILS", "emails granted the moderator role at login"),
+		listSetting(&c.AdminGroups, "ADMIN_GROUPS", "Entra group IDs granted the admin role"),
+		listSetting(&c.ModeratorGroups, "MODERATOR_GROUPS", "Entra group IDs granted the moderator role"),
+		listSetting(&c.AllowedEmailDomains, "ALLOWED_EMAIL_DOMAINS", "only these email domains can sign in"),
+		listSetting(&c.AllowedTenantIDs, "ALLOWED_TENANT_IDS", "only these tenants can sign in"),
+		listSetting(&c.AllowedGroups, "ALLOWED_GROUPS", "only members of these Entra groups can sign in"),
+
+		stringSetting(&c.SMTPHost, "SMTP_HOST", "", "mail server, mails are off without one"),
+		stringSetting(&c.SMTPPort, "SMTP_PORT", "25", "port of the mail server"),
+		stringSetting(&c.SMTPUsername, "SMTP_USERNAME", "", "user of the mail server"),
+		secret(stringSetting(&c.SMTPPassword, "SMTP_PASSWORD", "", "password of the mail server")),
+		stringSetting(&c.SMTPFrom, "SMTP_FROM", "Agora <agora@localhost>", "sender of the mails"),
+		intSetting(&c.DigestWeekday, "DIGEST_WEEKDAY", int(time.Monday), "weekday of the weekly digest, 0 is Sunday"),
+		intSetting(&c.DigestHour, "DIGEST_HOUR", 8, "hour of the digests"),
+
+		secret(listSetting(&c.TeamsWebhookURLs, "TEAMS_WEBHOOK_URLS", "Teams channels to post to")),
+		secret(listSetting(&c.SlackWebhookURLs, "SLACK_WEBHOOK_URLS", "Slack channels to post to")),
+		boolSetting(&c.ChatNewPosts, "CHAT_NEW_POSTS", true, "post new posts to the chat channels"),
+		intSetting(&c.ChatSummaryHour, "CHAT_SUMMARY_HOUR", 9, "hour of the daily chat summary, -1 turns it off"),
+
+		secret(stringSetting(&c.ScimSecret, "SCIM_SECRET", "", "bearer token of the SCIM endpoints, SCIM is off without one")),
+
+		stringSetting(&c.MetricsAddress, "METRICS_ADDRESS", "", "separate host:port to serve /metrics on"),
+		secret(stringSetting(&c.MetricsToken, "METRICS_TOKEN", "", "bearer token of /metrics, needed to serve it next to the app")),
+
+		stringSetting(&c.LogFormat, "LOG_FORMAT", "text", "text or json"),
+		stringSetting(&c.LogLevel, "LOG_LEVEL", "info", "debug, info, warn or error"),
+		listSetting(&c.LogLevels, "LOG_LEVELS", "levels per package, e.g. post=debug,server/auth=warn"),
+
+		boolSetting(&c.CookieSecure, "COOKIE_SECURE", false, "send the login cookie over HTTPS only, set it when served over HTTPS"),
+		stringSetting(&c.CookieSameSite, "COOKIE_SAME_SITE", "lax", "lax, strict or none, strict logs users out on links from other sites"),
+	}
+}
+
+// Validate checks the values, all problems are reported at once
+func (c Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(isPort(c.Port), "PORT must be a number between 1 and 65535, got '%s'", c.Port)
+	check(c.DBPath != "", "DB_PATH must not be empty")
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive, got %d", c.ShutdownTimeout)
+	check(c.BaseURL == "" || isURL(c.BaseURL), "BASE_URL must be an absolute URL, got '%s'", c.BaseURL)
+	check(c.AzureRedirectURL == "" || isURL(c.AzureRedirectURL), "AZURE_REDIRECT_URL must be an absolute URL, got '%s'", c.AzureRedirectURL)
+	check(c.RepostAfterDays >= 0, "REPOST_AFTER_DAYS must not be negative")
+	check(isPort(c.SMTPPort), "SMTP_PORT must be a number between 1 and 65535, got '%s'", c.SMTPPort)
+	check(c.DigestWeekday >= 0 && c.DigestWeekday <= 6, "DIGEST_WEEKDAY must be between 0 (Sunday) and 6, got %d", c.DigestWeekday)
+	check(c.DigestHour >= 0 && c.DigestHour <= 23, "DIGEST_HOUR must be between 0 and 23, got %d", c.DigestHour)
+	check(c.ChatSummaryHour >= -1 && c.ChatSummaryHour <= 23, "CHAT_SUMMARY_HOUR must be between 0 and 23 or -1 to turn it off, got %d", c.ChatSummaryHour)
+	check(c.MetricsAddress == "" || isAddress(c.MetricsAddress), "METRICS_ADDRESS must be host:port, got '%s'", c.MetricsAddress)
+	check(c.LogFormat == "text" || c.LogFormat == "json", "LOG_FORMAT must be text or json, got '%s'", c.LogFormat)
+	if _, err := c.LogOptions(); err != nil {
+		problems = append(problems, err)
+	}
+	check(c.CookieSameSite == "lax" || c.CookieSameSite == "strict" || c.CookieSameSite == "none", "COOKIE_SAME_SITE must be lax, strict or none, got '%s'", c.CookieSameSite)
+	check(c.CookieSameSite != "none" || c.CookieSecure, "COOKIE_SAME_SITE none needs COOKIE_SECURE, browsers drop the cookie otherwise")
+	for _, webhookURL := range append(c.TeamsWebhookURLs, c.SlackWebhookURLs...) {
+		check(isURL(webhookURL), "chat webhook URLs must be absolute URLs")
+	}
+
+	return errors.Join(problems...)
+}
+
+// ValidateLogin checks the settings the server needs
+// to log users in, other commands work without them
+func (c Config) ValidateLogin() error {
+	var problems []error
+	for _, required := range []struct{ key, value string }{
+		{"AZURE_TENANT_ID", c.AzureTenantID},
+		{"AZURE_CLIENT_ID", c.AzureClientID},
+		{"AZURE_CLIENT_SECRET", c.AzureClientSecret},
+		{"AZURE_REDIRECT_URL", c.AzureRedirectURL},
+		{"JWT_SECRET", c.JWTSecret},
+	} {
+		if required.value == "" {
+			problems = append(problems, fmt.Errorf("%s is required to serve", required.key))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// LogOptions sets up logging with log.Setup
+func (c Config) LogOptions() (log.Options, error) {
+	level, err := log.ParseLevel(c.LogLevel)
+	if err != nil {
+		return log.Options{}, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got '%s'", c.LogLevel)
+	}
+	packageLevels, err := log.ParsePackageLevels(c.LogLevels)
+	if err != nil {
+		return log.Options{}, fmt.Errorf("LOG_LEVELS %w", err)
+	}
+	return log.Options{Format: c.LogFormat, Level: level, PackageLevels: packageLevels}, nil
+}
+
+func isAddress(value string) bool {
+	_, port, err := net.SplitHostPort(value)
+	return err == nil && isPort(port)
+}
+
+func isPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port > 0 && port <= 65535
+}
+
+func isURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.Scheme != "" && parsed.Host != ""
+}
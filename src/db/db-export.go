@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+const exportVersion = 1
+
+// sqliteFormat is the format of CURRENT_TIMESTAMP, times are exported
+// like this so they still compare with it after an import
+const sqliteFormat = "2006-01-02 15:04:05"
+
+// Export is a copy of every table, independent of the SQLite file format
+type Export struct {
+	Version    int              `json:"version"`
+	ExportedAt string           `json:"exported_at"`
+	Tables     map[string]Table `json:"tables"`
+}
+
+type Table struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+var ErrNotEmpty = errors.New("database is not empty")
+
+// Export writes all tables as JSON
+func (db DB) Export(w io.Writer) error {
+	names, err := db.tableNames()
+	if err != nil {
+		return err
+	}
+
+	export := Export{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Tables:     map[string]Table{},
+	}
+	for _, name := range names {
+		table, err := db.exportTable(name)
+		if err != nil {
+			return fmt.Errorf("could not export table %s: %w", name, err)
+		}
+		export.Tables[name] = table
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+func (db DB) exportTable(name string) (Table, error) {
+	rows, err := db.Query(`SELECT * FROM "` + name + `"`)
+	if err != nil {
+		return Table{}, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return Table{}, err
+	}
+
+	table := Table{Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return Table{}, err
+		}
+		for i, value := range values {
+			switch v := value.(type) {
+			case []byte:
+				values[i] = string(v)
+			case time.Time:
+				values[i] = v.UTC().Format(sqliteFormat)
+			}
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	return table, rows.Err()
+}
+
+// Import inserts an export into a migrated but empty database,
+// columns the database does not have anymore are skipped
+func (db DB) Import(r io.Reader) (rowCount int, err error) {
+	decoder := json.NewDecoder(r)
+	// keeps IDs integers instead of floats
+	decoder.UseNumber()
+
+	var export Export
+	if err := decoder.Decode(&export); err != nil {
+		return 0, fmt.Errorf("could not read export: %w", err)
+	}
+	if export.Version != exportVersion {
+		return 0, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+
+	names, err := db.tableNames()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for name, table := range export.Tables {
+		if !slices.Contains(names, name) {
+			return 0, fmt.Errorf("table %s does not exist, run migrate first", name)
+		}
+
+		var count int
+		if err := tx.QueryRow(`SELECT count(*) FROM "` + name + `"`).Scan(&count); err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			return 0, fmt.Errorf("%w: table %s has rows", ErrNotEmpty, name)
+		}
+
+		inserted, err := importTable(tx, name, table)
+		if err != nil {
+			return 0, fmt.Errorf("could not import table %s: %w", name, err)
+		}
+		rowCount += inserted
+	}
+
+	return rowCount, tx.Commit()
+}
+
+func importTable(tx *sql.Tx, name string, table Table) (int, error) {
+	existing, err := columnNames(tx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	// indexes of the exported columns the table still has
+	var keep []int
+	var quoted []string
+	for i, column := range table.Columns {
+		if slices.Contains(existing, column) {
+			keep = append(keep, i)
+			quoted = append(quoted, `"`+column+`"`)
+		}
+	}
+	if len(keep) == 0 {
+		return 0, nil
+	}
+
+	statement, err := tx.Prepare(
+		`INSERT INTO "` + name + `" (` + strings.Join(quoted, ", ") + `)
+		 VALUES (` + strings.TrimSuffix(strings.Repeat("?, ", len(keep)), ", ") + `)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer statement.Close()
+
+	for _, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return 0, fmt.Errorf("row has %d values for %d columns", len(row), len(table.Columns))
+		}
+		args := make([]any, len(keep))
+		for i, index := range keep {
+			args[i] = importValue(row[index])
+		}
+		if _, err := statement.Exec(args...); err != nil {
+			return 0, err
+		}
+	}
+	return len(table.Rows), nil
+}
+
+func importValue(value any) any {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	f, _ := number.Float64()
+	return f
+}
+
+// tableNames leaves out the internal tables of SQLite
+func (db DB) tableNames() ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func columnNames(tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"agora/src/metrics"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+var (
+	queryDuration = metrics.NewHistogram(
+		"agora_db_query_duration_seconds",
+		"Duration of database statements by their first keyword, statements in transactions are not included.",
+		metrics.DefaultBuckets,
+		"statement",
+	)
+	queryErrors = metrics.NewCounter(
+		"agora_db_query_errors_total",
+		"Database statements that failed by their first keyword.",
+		"statement",
+	)
+)
+
+// Query, QueryRow and Exec time the statements of sql.DB,
+// errors of QueryRow only show up when scanning and are not counted
+func (db DB) Query(query string, args ...any) (*sql.Rows, error) {
+	defer observe(query, time.Now())
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		queryErrors.Inc(statement(query))
+	}
+	return rows, err
+}
+
+func (db DB) QueryRow(query string, args ...any) *sql.Row {
+	defer observe(query, time.Now())
+	return db.DB.QueryRow(query, args...)
+}
+
+func (db DB) Exec(query string, args ...any) (sql.Result, error) {
+	defer observe(query, time.Now())
+	result, err := db.DB.Exec(query, args...)
+	if err != nil {
+		queryErrors.Inc(statement(query))
+	}
+	return result, err
+}
+
+func observe(query string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), statement(query))
+}
+
+// statement is the first keyword, e.g. select or insert,
+// the full query would make too many series
+func statement(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	keyword := strings.ToLower(fields[0])
+	switch keyword {
+	case "select", "insert", "update", "delete", "with", "create", "alter", "pragma", "replace":
+		return keyword
+	}
+	return "other"
+}
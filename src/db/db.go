@@ -26,3 +26,37 @@ func (db DB) Close() error {
 	}
 	return db.DB.Close()
 }
+
+// Checkpoint moves the write-ahead log into the database file,
+// it does nothing if the database is not in WAL mode
+func (db DB) Checkpoint() error {
+	_, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// AddColumnIfMissing adds a column to an existing table.
+// CREATE TABLE IF NOT EXISTS does not touch tables created by older versions,
+// so new columns have to be added this way as well.
+func (db DB) AddColumnIfMissing(table, column, definition string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`ALTER TABLE "` + table + `" ADD COLUMN "` + column + `" ` + definition)
+	return err
+}
@@ -0,0 +1,33 @@
+// Package dbtest provides throwaway databases for tests
+package dbtest
+
+import (
+	"agora/src/db"
+	"path/filepath"
+	"testing"
+)
+
+// Open creates an empty database in the temporary directory of the test,
+// it is closed and removed when the test ends
+func Open(t testing.TB) *db.DB {
+	t.Helper()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "agora.db"))
+	if err != nil {
+		t.Fatalf("could not open test database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// Migrate runs the CreateDBTable functions of the handlers under test,
+// in the order the server runs them
+func Migrate(t testing.TB, migrations ...func() error) {
+	t.Helper()
+
+	for _, migration := range migrations {
+		if err := migration(); err != nil {
+			t.Fatalf("could not migrate test database: %v", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package event
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Bus lets modules react to changes in other modules
+// without depending on each other, e.g. notifications
+// are created when a comment is written without the comment
+// module knowing about notifications.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[Topic][]Subscriber
+}
+
+type Topic string
+
+const (
+	PostCreated    Topic = "post.created"
+	CommentCreated Topic = "comment.created"
+	VoteCreated    Topic = "vote.created"
+)
+
+// Topics lists every topic, e.g. for subscribers to choose from
+var Topics = []Topic{
+	PostCreated,
+	CommentCreated,
+	VoteCreated,
+}
+
+type Event struct {
+	Topic      Topic
+	Payload    any
+	OccurredAt time.Time
+}
+
+type Subscriber func(Event)
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: map[Topic][]Subscriber{},
+	}
+}
+
+func (b *Bus) Subscribe(topic Topic, subscriber Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[topic] = append(b.subscribers[topic], subscriber)
+}
+
+// Publish calls the subscribers of the topic one after another.
+// Subscribers doing slow work like network calls should queue it
+// instead of blocking the request that published the event.
+func (b *Bus) Publish(topic Topic, payload any) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers[topic]
+	b.mu.RUnlock()
+
+	event := Event{
+		Topic:      topic,
+		Payload:    payload,
+		OccurredAt: time.Now(),
+	}
+	for _, subscriber := range subscribers {
+		deliver(subscriber, event)
+	}
+}
+
+func deliver(subscriber Subscriber, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("event subscriber panicked", "topic", event.Topic, "panic", r)
+		}
+	}()
+	subscriber(event)
+}
@@ -0,0 +1,25 @@
+package event
+
+type PostCreatedPayload struct {
+	PostID      int64
+	Title       string
+	URL         string
+	Description string
+	UserID      string
+}
+
+type CommentCreatedPayload struct {
+	CommentID int64
+	PostID    int
+	// ParentID is the comment this one replies to, 0 for top level comments
+	ParentID int64
+	UserID   string
+	Text     string
+}
+
+// VoteCreatedPayload has either PostID or CommentID set
+type VoteCreatedPayload struct {
+	PostID    int64
+	CommentID int64
+	UserID    string
+}
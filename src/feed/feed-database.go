@@ -0,0 +1,74 @@
+package feed
+
+import (
+	"agora/src/user"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS feed_tokens (
+		fk_user_id TEXT PRIMARY KEY,
+		token TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id)
+	);
+`
+
+func (fh *FeedHandler) CreateDBTable() error {
+	_, err := fh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating feed tokens table", "err", err)
+		return err
+	}
+	return nil
+}
+
+// queryUserByToken returns false if no user has this token,
+// tokens of suspended users do not work either
+func (fh *FeedHandler) queryUserByToken(token string) (user.User, bool, error) {
+	var u user.User
+	err := fh.db.QueryRow(
+		`SELECT u.id, u.name, u.email, u.role
+		 FROM feed_tokens ft
+		 JOIN users u ON u.id = ft.fk_user_id
+		 WHERE ft.token = ? AND NOT `+user.SuspendedColumn,
+		token,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.Role)
+	if err == sql.ErrNoRows {
+		return user.User{}, false, nil
+	}
+	if err != nil {
+		return user.User{}, false, err
+	}
+	return u, true, nil
+}
+
+func (fh *FeedHandler) queryToken(userID string) (string, error) {
+	var token string
+	err := fh.db.QueryRow(`SELECT token FROM feed_tokens WHERE fk_user_id = ?`, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return token, err
+}
+
+// regenerateToken replaces the token of the user,
+// feed urls with the old token stop working
+func (fh *FeedHandler) regenerateToken(userID string) error {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	_, err := fh.db.Exec(
+		`INSERT INTO feed_tokens (fk_user_id, token) VALUES (?, ?)
+		 ON CONFLICT(fk_user_id) DO UPDATE SET token = excluded.token, created_at = CURRENT_TIMESTAMP`,
+		userID,
+		hex.EncodeToString(secret),
+	)
+	return err
+}
@@ -0,0 +1,30 @@
+package feed
+
+import (
+	"agora/src/audit"
+	"agora/src/db"
+	"agora/src/post"
+	"agora/src/post/comment"
+)
+
+const feedSize = 50
+
+// FeedHandler serves Atom and RSS feeds. Feed readers can not log in,
+// so feeds are authenticated with a secret token per user in the url.
+type FeedHandler struct {
+	db      *db.DB
+	ph      *post.PostHandler
+	ch      *comment.CommentHandler
+	ah      *audit.AuditHandler
+	baseURL string
+}
+
+func NewFeedHandler(db *db.DB, ph *post.PostHandler, ch *comment.CommentHandler, ah *audit.AuditHandler, baseURL string) *FeedHandler {
+	return &FeedHandler{
+		db:      db,
+		ph:      ph,
+		ch:      ch,
+		ah:      ah,
+		baseURL: baseURL,
+	}
+}
@@ -0,0 +1,220 @@
+package feed
+
+import (
+	"agora/src/audit"
+	"agora/src/post"
+	"agora/src/post/tag"
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/user"
+	_ "embed"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed feed-settings.html
+var feedSettingsTemplate string
+
+// TopFeedGETHandler serves the posts in the order of the front page
+func (fh *FeedHandler) TopFeedGETHandler(w http.ResponseWriter, r *http.Request) {
+	fh.servePostFeed(w, r, "Agora: Top Posts", fh.baseURL+"/posts", post.PostListFilter{})
+}
+
+func (fh *FeedHandler) NewFeedGETHandler(w http.ResponseWriter, r *http.Request) {
+	fh.servePostFeed(w, r, "Agora: New Posts", fh.baseURL+"/posts", post.PostListFilter{OrderByNewest: true})
+}
+
+func (fh *FeedHandler) TagFeedGETHandler(w http.ResponseWriter, r *http.Request) {
+	tagName := tag.Normalize(mux.Vars(r)["tag"])
+	if tagName == "" {
+		http.NotFound(w, r)
+		return
+	}
+	fh.servePostFeed(w, r, "Agora: #"+tagName, fh.baseURL+"/tags/"+tagName, post.PostListFilter{Tag: tagName, OrderByNewest: true})
+}
+
+func (fh *FeedHandler) CommentFeedGETHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := fh.authenticate(w, r); !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	record, err := fh.ph.QueryOnePost(postID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query post for feed", "postID", postID, "err", err)
+		http.Error(w, "Could not retrieve post", http.StatusInternalServerError)
+		return
+	}
+	if record.ID == 0 {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	comments, err := fh.ch.QueryAllCommentyByPostID(postID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query comments for feed", "postID", postID, "err", err)
+		http.Error(w, "Could not retrieve comments", http.StatusInternalServerError)
+		return
+	}
+
+	postTitle := plain(record.Title)
+	postLink := fmt.Sprintf("%s/posts/%d", fh.baseURL, postID)
+	feed := Feed{
+		Title:       "Agora: Comments on " + postTitle,
+		Description: "Comments on " + postTitle,
+		Link:        postLink,
+	}
+
+	// newest first, readers only keep the latest entries
+	for i := len(comments) - 1; i >= 0 && len(feed.Entries) < feedSize; i-- {
+		comment := comments[i]
+		feed.Entries = append(feed.Entries, Entry{
+			Title:     comment.UserName + " on " + postTitle,
+			Link:      fmt.Sprintf("%s/#comment-%d", postLink, comment.ID),
+			Author:    comment.UserName,
+			Summary:   plain(comment.Text),
+			Published: parseDate(comment.CreatedAt),
+		})
+	}
+
+	fh.write(w, r, feed)
+}
+
+func (fh *FeedHandler) servePostFeed(w http.ResponseWriter, r *http.Request, title string, link string, filter post.PostListFilter) {
+	u, ok := fh.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := fh.ph.QueryAllPostsForTheList(u.ID, filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query posts for feed", "title", title, "err", err)
+		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
+		return
+	}
+
+	feed := Feed{
+		Title:       title,
+		Description: title,
+		Link:        link,
+	}
+	for _, record := range records[:min(feedSize, len(records))] {
+		feed.Entries = append(feed.Entries, Entry{
+			Title:      plain(record.Title),
+			Link:       fmt.Sprintf("%s/posts/%d", fh.baseURL, record.ID),
+			Author:     record.FUserName,
+			Summary:    plain(record.Description),
+			Published:  parseDate(record.CreatedAt),
+			RelatedURL: record.URL.String,
+		})
+	}
+
+	fh.write(w, r, feed)
+}
+
+func (fh *FeedHandler) write(w http.ResponseWriter, r *http.Request, feed Feed) {
+	if err := writeFeed(w, feed, mux.Vars(r)["format"]); err != nil {
+		slog.ErrorContext(r.Context(), "could not write feed", "path", r.URL.Path, "err", err)
+	}
+}
+
+// authenticate accepts the feed token from the url and falls back to
+// the logged in user, so feeds can also be opened in the browser
+func (fh *FeedHandler) authenticate(w http.ResponseWriter, r *http.Request) (user.User, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		if u, ok := r.Context().Value("user").(user.User); ok {
+			return u, true
+		}
+		http.Error(w, "Feed token missing, get your feed links at /settings/feeds", http.StatusUnauthorized)
+		return user.User{}, false
+	}
+
+	u, found, err := fh.queryUserByToken(token)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query feed token", "err", err)
+		http.Error(w, "Could not check feed token", http.StatusInternalServerError)
+		return user.User{}, false
+	}
+	if !found {
+		http.Error(w, "Invalid feed token", http.StatusUnauthorized)
+		return user.User{}, false
+	}
+	return u, true
+}
+
+func (fh *FeedHandler) FeedSettingsGETHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := fh.queryToken(u.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query feed token", "userID", u.ID, "err", err)
+		http.Error(w, "Could not retrieve feed settings", http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(
+		w,
+		"feed-settings.html",
+		&render.Page{
+			Title: "Feeds",
+			Data: struct {
+				Token   string
+				BaseURL string
+			}{
+				Token:   token,
+				BaseURL: fh.baseURL,
+			},
+		},
+		r.Context(),
+		feedSettingsTemplate,
+	)
+}
+
+// FeedTokenPOSTHandler creates a new token, the old one stops working
+func (fh *FeedHandler) FeedTokenPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	if err := fh.regenerateToken(u.ID); err != nil {
+		slog.ErrorContext(r.Context(), "could not create feed token", "userID", u.ID, "err", err)
+		http.Error(w, "Could not create feed token", http.StatusInternalServerError)
+		return
+	}
+
+	fh.ah.Record(r, u.ID, audit.FeedTokenCreated, audit.UserTarget(u.ID), "")
+	slog.InfoContext(r.Context(), "created feed token", "userID", u.ID)
+	http.Redirect(w, r, "/settings/feeds", http.StatusSeeOther)
+}
+
+// plain reverts the html escaping done by sanitize on user input,
+// the xml encoder escapes again
+func plain(text string) string {
+	return html.UnescapeString(text)
+}
+
+func parseDate(value string) time.Time {
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		slog.Warn("could not parse date for feed", "date", value, "err", err)
+	}
+	return date
+}
@@ -0,0 +1,174 @@
+package feed
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+)
+
+// Feed is written as Atom or RSS depending on the requested format
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	Entries     []Entry
+}
+
+type Entry struct {
+	Title     string
+	Link      string
+	Author    string
+	Summary   string
+	Published time.Time
+	// RelatedURL is the link a post was submitted with
+	RelatedURL string
+}
+
+func (f Feed) updated() time.Time {
+	var updated time.Time
+	for _, entry := range f.Entries {
+		if entry.Published.After(updated) {
+			updated = entry.Published
+		}
+	}
+	if updated.IsZero() {
+		return time.Now()
+	}
+	return updated
+}
+
+const (
+	formatAtom = "atom"
+	formatRSS  = "rss"
+)
+
+func writeFeed(w http.ResponseWriter, f Feed, format string) error {
+	var document any
+	switch format {
+	case formatRSS:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		document = f.rss()
+	default:
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		document = f.atom()
+	}
+
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(document)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Author    atomAuthor `xml:"author"`
+	Summary   atomText   `xml:"summary"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (f Feed) atom() atomFeed {
+	feed := atomFeed{
+		Title:   f.Title,
+		ID:      f.Link,
+		Updated: f.updated().UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: f.Link, Rel: "alternate"},
+	}
+
+	for _, entry := range f.Entries {
+		published := entry.Published.UTC().Format(time.RFC3339)
+		links := []atomLink{{Href: entry.Link, Rel: "alternate"}}
+		if entry.RelatedURL != "" {
+			links = append(links, atomLink{Href: entry.RelatedURL, Rel: "related"})
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:     entry.Title,
+			ID:        entry.Link,
+			Links:     links,
+			Published: published,
+			Updated:   published,
+			Author:    atomAuthor{Name: entry.Author},
+			Summary:   atomText{Type: "text", Body: entry.Summary},
+		})
+	}
+
+	return feed
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (f Feed) rss() rssDocument {
+	channel := rssChannel{
+		Title:         f.Title,
+		Link:          f.Link,
+		Description:   f.Description,
+		LastBuildDate: f.updated().UTC().Format(time.RFC1123Z),
+	}
+
+	for _, entry := range f.Entries {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: entry.Link},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+			Creator:     entry.Author,
+			Description: entry.Summary,
+		})
+	}
+
+	return rssDocument{Version: "2.0", Channel: channel}
+}
@@ -0,0 +1,52 @@
+package health
+
+import (
+	"sync"
+)
+
+// Check reports why a dependency is not ready, nil if it is
+type Check func() error
+
+// HealthHandler answers the probes of the deployment,
+// none of its endpoints need a login
+type HealthHandler struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{
+		checks: map[string]Check{},
+	}
+}
+
+// AddCheck adds a dependency to /readyz, the instance
+// is only ready if every check passes
+func (hh *HealthHandler) AddCheck(name string, check Check) {
+	hh.mu.Lock()
+	defer hh.mu.Unlock()
+	if _, exists := hh.checks[name]; !exists {
+		hh.names = append(hh.names, name)
+	}
+	hh.checks[name] = check
+}
+
+// runChecks returns the result of every check by name
+// and whether all of them passed
+func (hh *HealthHandler) runChecks() (map[string]string, bool) {
+	hh.mu.RLock()
+	defer hh.mu.RUnlock()
+
+	results := map[string]string{}
+	ready := true
+	for _, name := range hh.names {
+		if err := hh.checks[name](); err != nil {
+			results[name] = err.Error()
+			ready = false
+			continue
+		}
+		results[name] = "ok"
+	}
+	return results, ready
+}
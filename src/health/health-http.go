@@ -0,0 +1,48 @@
+package health
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// HealthzGETHandler answers as long as the process serves requests
+func (hh *HealthHandler) HealthzGETHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// ReadyzGETHandler answers 503 while a dependency is not ready,
+// the body lists the result of every check
+func (hh *HealthHandler) ReadyzGETHandler(w http.ResponseWriter, r *http.Request) {
+	results, ready := hh.runChecks()
+
+	status := http.StatusOK
+	body := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ready",
+		Checks: results,
+	}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body.Status = "not ready"
+		slog.WarnContext(r.Context(), "instance is not ready", "checks", results)
+	}
+
+	writeJSON(w, status, body)
+}
+
+func (hh *HealthHandler) VersionGETHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, BuildVersion())
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("could not write health response", "err", err)
+	}
+}
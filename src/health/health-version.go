@@ -0,0 +1,48 @@
+package health
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildDate are set at build time:
+// go build -ldflags "-X agora/src/health.Commit=... -X agora/src/health.BuildDate=..."
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+type Version struct {
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// BuildVersion falls back to the VCS information Go embeds
+// when the binary was built without the ldflags
+func BuildVersion() Version {
+	version := Version{
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && version.Commit == "":
+				version.Commit = setting.Value
+			case setting.Key == "vcs.time" && version.BuildDate == "":
+				version.BuildDate = setting.Value
+			}
+		}
+	}
+
+	if version.Commit == "" {
+		version.Commit = "unknown"
+	}
+	if version.BuildDate == "" {
+		version.BuildDate = "unknown"
+	}
+	return version
+}
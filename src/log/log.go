@@ -1,55 +1,201 @@
 package log
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-var (
-	// Debug _
-	Debug *log.Logger = log.New(
-		os.Stdout,
-		"DEBUG: ",
-		log.Lshortfile,
-	)
-	// Trace _
-	Trace *log.Logger = log.New(
-		os.Stdout,
-		"TRACE : ",
-		log.Ldate|log.Ltime|log.Lshortfile,
-	)
-	// Info _
-	Info *log.Logger = log.New(
-		os.Stdout,
-		"INFO: ",
-		log.Ldate|log.Ltime|log.Lshortfile,
-	)
-	// Warning _
-	Warning *log.Logger = log.New(
-		os.Stdout,
-		"⚠️ WARNING: ",
-		log.Ldate|log.Ltime|log.Lshortfile,
-	)
-	// Error _
-	Error *log.Logger = log.New(
-		os.Stderr,
-		"🔥  ERROR: ",
-		log.Ldate|log.Ltime|log.Llongfile,
-	)
-	// Test _
-	Test *log.Logger = log.New(
-		os.Stderr,
-		"TEST: ",
-		log.Ldate|log.Ltime|log.Lshortfile,
-	)
-	// Pretty _
-	Pretty = func(objs ...interface{}) {
-		prettyString, err := json.MarshalIndent(objs, "", "  ")
+// Logging goes through log/slog, this package only sets it up:
+// the output format, a level per package and the request ID
+// of the context added to every record logged with it.
+//
+//	slog.ErrorContext(r.Context(), "could not query post", "postID", postID, "err", err)
+
+// modulePrefix is cut from function names to get the package, e.g. post/comment
+const modulePrefix = "agora/src/"
+
+type Options struct {
+	// Format is text or json
+	Format string
+	Level  slog.Level
+	// PackageLevels override the level for a package and
+	// the packages below it, e.g. post also applies to post/comment
+	PackageLevels map[string]slog.Level
+}
+
+func init() {
+	Setup(os.Stderr, Options{Format: "text", Level: slog.LevelInfo})
+}
+
+// Setup replaces the default logger of slog,
+// records of the standard log package end up there as well
+func Setup(w io.Writer, options Options) {
+	handlerOptions := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       slog.LevelDebug,
+		ReplaceAttr: shortSource,
+	}
+
+	var next slog.Handler = slog.NewTextHandler(w, handlerOptions)
+	if options.Format == "json" {
+		next = slog.NewJSONHandler(w, handlerOptions)
+	}
+
+	slog.SetDefault(slog.New(newHandler(next, options)))
+}
+
+// ParseLevel accepts debug, info, warn and error
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(value))
+	return level, err
+}
+
+// ParsePackageLevels reads entries like post=debug
+func ParsePackageLevels(entries []string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, entry := range entries {
+		pkg, value, found := strings.Cut(entry, "=")
+		if !found || pkg == "" {
+			return nil, fmt.Errorf("'%s' is not package=level", entry)
+		}
+		level, err := ParseLevel(value)
 		if err != nil {
-			Error.Printf("error: %s", err)
+			return nil, fmt.Errorf("'%s' has an unknown level: %w", entry, err)
 		}
+		levels[strings.Trim(pkg, "/")] = level
+	}
+	return levels, nil
+}
+
+// Fatal logs the error and exits, only for errors at startup
+func Fatal(msg string, args ...any) {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	record := slog.NewRecord(time.Now(), slog.LevelError, msg, pcs[0])
+	record.Add(args...)
+	slog.Default().Handler().Handle(context.Background(), record)
+	os.Exit(1)
+}
+
+type requestIDKey struct{}
 
-		Debug.Printf("%s", prettyString)
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID is empty outside of requests
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// handler filters records by the level of the package they are
+// logged in and adds the request ID of the context
+type handler struct {
+	next     slog.Handler
+	level    slog.Level
+	packages map[string]slog.Level
+	// prefixes are the packages with their own level, longest first
+	prefixes []string
+	// minimum is the lowest level of any package,
+	// the package is only known once the record is created
+	minimum slog.Level
+	cache   *sync.Map
+}
+
+func newHandler(next slog.Handler, options Options) *handler {
+	h := &handler{
+		next:     next,
+		level:    options.Level,
+		packages: options.PackageLevels,
+		minimum:  options.Level,
+		cache:    &sync.Map{},
 	}
-)
+	for pkg, level := range options.PackageLevels {
+		h.prefixes = append(h.prefixes, pkg)
+		h.minimum = min(h.minimum, level)
+	}
+	sort.Slice(h.prefixes, func(i, j int) bool { return len(h.prefixes[i]) > len(h.prefixes[j]) })
+	return h
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.minimum
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < h.levelAt(record.PC) {
+		return nil
+	}
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+// levelAt is the level of the package the record was logged in
+func (h *handler) levelAt(pc uintptr) slog.Level {
+	if len(h.prefixes) == 0 || pc == 0 {
+		return h.level
+	}
+	if level, found := h.cache.Load(pc); found {
+		return level.(slog.Level)
+	}
+
+	level := h.level
+	pkg := packageOf(pc)
+	for _, prefix := range h.prefixes {
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			level = h.packages[prefix]
+			break
+		}
+	}
+	h.cache.Store(pc, level)
+	return level
+}
+
+// packageOf turns agora/src/post/comment.(*CommentHandler).X into post/comment
+func packageOf(pc uintptr) string {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	name := strings.TrimPrefix(frame.Function, modulePrefix)
+	lastSlash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[lastSlash+1:], "."); dot >= 0 {
+		name = name[:lastSlash+1+dot]
+	}
+	return name
+}
+
+// shortSource logs the source as dir/file.go:line instead of the full path
+func shortSource(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Key != slog.SourceKey || len(groups) > 0 {
+		return attr
+	}
+	source, ok := attr.Value.Any().(*slog.Source)
+	if !ok {
+		return attr
+	}
+	file := filepath.Join(filepath.Base(filepath.Dir(source.File)), filepath.Base(source.File))
+	return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", file, source.Line))
+}
@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS mail_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_mail_queue_due ON mail_queue(sent_at, next_attempt_at);
+
+	CREATE TABLE IF NOT EXISTS mail_preferences (
+		fk_user_id TEXT PRIMARY KEY,
+		comments_on_my_posts BOOLEAN NOT NULL DEFAULT 0,
+		weekly_digest BOOLEAN NOT NULL DEFAULT 0,
+
+		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS mail_digests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+`
+
+func (mh *MailHandler) CreateDBTable() error {
+	_, err := mh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating mail tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (mh *MailHandler) insertQueuedMessage(message Message) error {
+	_, err := mh.db.Exec(
+		`INSERT INTO mail_queue (recipient, subject, body) VALUES (?, ?, ?)`,
+		message.To,
+		message.Subject,
+		message.Body,
+	)
+	if err != nil {
+		slog.Error("error queueing mail", "err", err)
+	}
+	return err
+}
+
+func (mh *MailHandler) queryDueMessages() ([]queuedMessage, error) {
+	rows, err := mh.db.Query(
+		`SELECT id, recipient, subject, body, attempts
+		 FROM mail_queue
+		 WHERE sent_at IS NULL
+		 AND attempts < ?
+		 AND next_attempt_at <= CURRENT_TIMESTAMP
+		 ORDER BY id
+		 LIMIT 50`,
+		maxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []queuedMessage
+	for rows.Next() {
+		var message queuedMessage
+		err := rows.Scan(
+			&message.ID,
+			&message.To,
+			&message.Subject,
+			&message.Body,
+			&message.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+func (mh *MailHandler) markSent(id int64) error {
+	_, err := mh.db.Exec(
+		`UPDATE mail_queue SET sent_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = ?`,
+		id,
+	)
+	return err
+}
+
+func (mh *MailHandler) markFailed(id int64, attempts int, retryIn time.Duration, lastError string) error {
+	_, err := mh.db.Exec(
+		`UPDATE mail_queue
+		 SET attempts = ?, last_error = ?, next_attempt_at = datetime('now', '+' || ? || ' seconds')
+		 WHERE id = ?`,
+		attempts,
+		lastError,
+		int(retryIn.Seconds()),
+		id,
+	)
+	return err
+}
+
+func (mh *MailHandler) queryPreferences(userID string) (Preferences, error) {
+	var preferences Preferences
+	err := mh.db.QueryRow(
+		`SELECT comments_on_my_posts, weekly_digest FROM mail_preferences WHERE fk_user_id = ?`,
+		userID,
+	).Scan(&preferences.CommentsOnMyPosts, &preferences.WeeklyDigest)
+	if err == sql.ErrNoRows {
+		return Preferences{}, nil
+	}
+	return preferences, err
+}
+
+func (mh *MailHandler) upsertPreferences(userID string, preferences Preferences) error {
+	_, err := mh.db.Exec(
+		`INSERT INTO mail_preferences (fk_user_id, comments_on_my_posts, weekly_digest)
+		 VALUES (?, ?, ?)
+		 ON CONFLICT(fk_user_id) DO UPDATE SET
+			comments_on_my_posts = excluded.comments_on_my_posts,
+			weekly_digest = excluded.weekly_digest`,
+		userID,
+		preferences.CommentsOnMyPosts,
+		preferences.WeeklyDigest,
+	)
+	return err
+}
+
+// queryPostAuthorForMail returns email and name of the post author
+// if they opted in to mails about comments on their posts
+func (mh *MailHandler) queryPostAuthorForMail(postID int) (recipient, bool, error) {
+	var r recipient
+	err := mh.db.QueryRow(
+		`SELECT u.id, u.name, u.email, p.title
+		 FROM posts p
+		 JOIN users u ON u.id = p.fk_user_id
+		 JOIN mail_preferences mp ON mp.fk_user_id = u.id
+		 WHERE p.id = ? AND mp.comments_on_my_posts`,
+		postID,
+	).Scan(&r.UserID, &r.Name, &r.Email, &r.PostTitle)
+	if err == sql.ErrNoRows {
+		return recipient{}, false, nil
+	}
+	if err != nil {
+		return recipient{}, false, err
+	}
+	return r, true, nil
+}
+
+type recipient struct {
+	UserID    string
+	Name      string
+	Email     string
+	PostTitle string
+}
+
+func (mh *MailHandler) queryDigestRecipients() ([]recipient, error) {
+	rows, err := mh.db.Query(
+		`SELECT u.id, u.name, u.email
+		 FROM users u
+		 JOIN mail_preferences mp ON mp.fk_user_id = u.id
+		 WHERE mp.weekly_digest`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Email); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+func (mh *MailHandler) queryLastDigest() (time.Time, error) {
+	var sentAt time.Time
+	err := mh.db.QueryRow(`SELECT sent_at FROM mail_digests ORDER BY sent_at DESC LIMIT 1`).Scan(&sentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return sentAt, err
+}
+
+func (mh *MailHandler) insertDigest() error {
+	_, err := mh.db.Exec(`INSERT INTO mail_digests DEFAULT VALUES`)
+	return err
+}
@@ -0,0 +1,108 @@
+package mail
+
+import (
+	"agora/src/db"
+	"agora/src/event"
+	"agora/src/post"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const pollInterval = 30 * time.Second
+const maxAttempts = 6
+
+// MailHandler queues outgoing mails in the database and
+// sends them in the background, failed sends are retried with backoff
+type MailHandler struct {
+	db     *db.DB
+	config Config
+	ph     *post.PostHandler
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func NewMailHandler(db *db.DB, config Config, ph *post.PostHandler, bus *event.Bus) *MailHandler {
+	mh := &MailHandler{
+		db:     db,
+		config: config,
+		ph:     ph,
+		stop:   make(chan struct{}),
+	}
+	bus.Subscribe(event.CommentCreated, mh.onCommentCreated)
+	return mh
+}
+
+// Enqueue stores the message, it is sent by the worker started with Start
+func (mh *MailHandler) Enqueue(message Message) error {
+	if !mh.config.Enabled() {
+		return nil
+	}
+	return mh.insertQueuedMessage(message)
+}
+
+func (mh *MailHandler) Start() {
+	if !mh.config.Enabled() {
+		slog.Info("mail is disabled, SMTP_HOST is not set")
+		return
+	}
+
+	mh.stopped.Add(1)
+	go func() {
+		defer mh.stopped.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			mh.sendDueMessages()
+			mh.sendDigestIfDue(time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-mh.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the mail currently being sent, queued mails stay
+// in the database and are sent after the next start
+func (mh *MailHandler) Stop() {
+	if !mh.config.Enabled() {
+		return
+	}
+	close(mh.stop)
+	mh.stopped.Wait()
+}
+
+func (mh *MailHandler) sendDueMessages() {
+	messages, err := mh.queryDueMessages()
+	if err != nil {
+		slog.Error("could not query mail queue", "err", err)
+		return
+	}
+
+	for _, message := range messages {
+		err := mh.send(message.Message)
+		if err == nil {
+			if err := mh.markSent(message.ID); err != nil {
+				slog.Error("could not mark mail as sent", "id", message.ID, "err", err)
+			}
+			continue
+		}
+
+		attempts := message.Attempts + 1
+		slog.Warn("could not send mail", "id", message.ID, "attempt", attempts, "err", err)
+		if err := mh.markFailed(message.ID, attempts, backoff(attempts), err.Error()); err != nil {
+			slog.Error("could not update mail queue", "id", message.ID, "err", err)
+		}
+	}
+}
+
+// backoff doubles the wait time with every attempt, starting at one minute
+func backoff(attempts int) time.Duration {
+	return time.Minute * time.Duration(1<<(attempts-1))
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"agora/src/render"
+	"agora/src/server/auth"
+	_ "embed"
+	"log/slog"
+	"net/http"
+)
+
+//go:embed mail-settings.html
+var mailSettingsTemplate string
+
+func (mh *MailHandler) MailSettingsGETHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	preferences, err := mh.queryPreferences(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query mail preferences", "userID", user.ID, "err", err)
+		http.Error(w, "Could not retrieve mail settings", http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(
+		w,
+		"mail-settings.html",
+		&render.Page{
+			Title: "Email Settings",
+			Data: struct {
+				Preferences
+				Enabled bool
+				Saved   bool
+			}{
+				Preferences: preferences,
+				Enabled:     mh.config.Enabled(),
+				Saved:       r.URL.Query().Get("saved") != "",
+			},
+		},
+		r.Context(),
+		mailSettingsTemplate,
+	)
+}
+
+func (mh *MailHandler) MailSettingsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	preferences := Preferences{
+		CommentsOnMyPosts: r.FormValue("comments_on_my_posts") == "on",
+		WeeklyDigest:      r.FormValue("weekly_digest") == "on",
+	}
+
+	if err := mh.upsertPreferences(user.ID, preferences); err != nil {
+		slog.ErrorContext(r.Context(), "could not save mail preferences", "userID", user.ID, "err", err)
+		http.Error(w, "Could not save mail settings", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings/email?saved=1", http.StatusSeeOther)
+}
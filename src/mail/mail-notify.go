@@ -0,0 +1,145 @@
+package mail
+
+import (
+	"agora/src/event"
+	"agora/src/post"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const digestSize = 10
+
+func (mh *MailHandler) onCommentCreated(e event.Event) {
+	if !mh.config.Enabled() {
+		return
+	}
+
+	payload, ok := e.Payload.(event.CommentCreatedPayload)
+	if !ok {
+		slog.Error("unexpected payload", "topic", e.Topic, "payload", e.Payload)
+		return
+	}
+
+	author, optedIn, err := mh.queryPostAuthorForMail(payload.PostID)
+	if err != nil {
+		slog.Error("could not query post author for mail", "postID", payload.PostID, "err", err)
+		return
+	}
+	if !optedIn || author.UserID == payload.UserID {
+		return
+	}
+
+	link := fmt.Sprintf("%s/posts/%d/#comment-%d", mh.config.BaseURL, payload.PostID, payload.CommentID)
+	body := fmt.Sprintf(
+		"Hi %s,\n\nthere is a new comment on your post \"%s\":\n\n%s\n\nReply on Agora: %s\n\n%s",
+		author.Name,
+		plain(author.PostTitle),
+		quote(plain(payload.Text)),
+		link,
+		mh.footer(),
+	)
+
+	mh.Enqueue(Message{
+		To:      author.Email,
+		Subject: "New comment on \"" + plain(author.PostTitle) + "\"",
+		Body:    body,
+	})
+}
+
+// sendDigestIfDue queues the weekly digest once the configured
+// weekday and hour are reached and no digest went out this week
+func (mh *MailHandler) sendDigestIfDue(now time.Time) {
+	if now.Weekday() != mh.config.DigestWeekday || now.Hour() < mh.config.DigestHour {
+		return
+	}
+
+	lastDigest, err := mh.queryLastDigest()
+	if err != nil {
+		slog.Error("could not query last digest", "err", err)
+		return
+	}
+	if now.Sub(lastDigest) < 6*24*time.Hour {
+		return
+	}
+
+	if err := mh.insertDigest(); err != nil {
+		slog.Error("could not record digest", "err", err)
+		return
+	}
+
+	if err := mh.SendDigest(now); err != nil {
+		slog.Error("could not send digest", "err", err)
+	}
+}
+
+// SendDigest queues the top posts of the last week for everyone who opted in
+func (mh *MailHandler) SendDigest(now time.Time) error {
+	records, err := mh.ph.QueryAllPostsForTheList("", post.PostListFilter{})
+	if err != nil {
+		return err
+	}
+
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	var lines []string
+	for _, record := range records {
+		createdAt, err := time.Parse(time.RFC3339, record.CreatedAt)
+		if err != nil || createdAt.Before(weekAgo) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"%d. %s\n   %d votes, %d comments: %s/posts/%d",
+			len(lines)+1,
+			plain(record.Title),
+			record.FNrOfVotes,
+			record.FNrOfComments,
+			mh.config.BaseURL,
+			record.ID,
+		))
+		if len(lines) == digestSize {
+			break
+		}
+	}
+
+	if len(lines) == 0 {
+		slog.Info("no posts this week, skipping digest")
+		return nil
+	}
+
+	recipients, err := mh.queryDigestRecipients()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		mh.Enqueue(Message{
+			To:      r.Email,
+			Subject: "Top posts on Agora this week",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nthis is what the Agora talked about this week:\n\n%s\n\n%s",
+				r.Name,
+				strings.Join(lines, "\n\n"),
+				mh.footer(),
+			),
+		})
+	}
+
+	slog.Info("queued weekly digest", "recipients", len(recipients), "posts", len(lines))
+	return nil
+}
+
+func (mh *MailHandler) footer() string {
+	return "--\nYou get this mail because you opted in at " + mh.config.BaseURL + "/settings/email"
+}
+
+// plain reverts the html escaping done by sanitize on user input
+func plain(text string) string {
+	return html.UnescapeString(text)
+}
+
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+func (mh *MailHandler) send(message Message) error {
+	address := net.JoinHostPort(mh.config.Host, mh.config.Port)
+
+	// a local sink usually needs no authentication, and net/smtp
+	// refuses plain auth over unencrypted connections to other hosts anyway
+	var auth smtp.Auth
+	if mh.config.Username != "" {
+		auth = smtp.PlainAuth("", mh.config.Username, mh.config.Password, mh.config.Host)
+	}
+
+	envelopeFrom := mh.config.From
+	if parsed, err := netmail.ParseAddress(mh.config.From); err == nil {
+		envelopeFrom = parsed.Address
+	}
+
+	return smtp.SendMail(
+		address,
+		auth,
+		envelopeFrom,
+		[]string{message.To},
+		mh.format(message),
+	)
+}
+
+func (mh *MailHandler) format(message Message) []byte {
+	headers := []string{
+		"From: " + mh.config.From,
+		"To: " + message.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(mh.config.From),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\n", "\r\n")
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
+
+func messageID(from string) string {
+	domain := "agora.local"
+	if at := strings.LastIndex(from, "@"); at != -1 {
+		domain = strings.Trim(from[at+1:], "<> ")
+	}
+
+	random := make([]byte, 12)
+	rand.Read(random)
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain)
+}
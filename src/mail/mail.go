@@ -0,0 +1,39 @@
+package mail
+
+import "time"
+
+type Config struct {
+	// Host of the SMTP server, sending mail is disabled if empty.
+	// For local development point it to a sink like mailpit on localhost:1025.
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// BaseURL is used to build absolute links in the mails
+	BaseURL string
+
+	DigestWeekday time.Weekday
+	DigestHour    int
+}
+
+func (c Config) Enabled() bool {
+	return c.Host != ""
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Preferences struct {
+	CommentsOnMyPosts bool
+	WeeklyDigest      bool
+}
+
+type queuedMessage struct {
+	ID       int64
+	Attempts int
+	Message
+}
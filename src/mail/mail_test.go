@@ -0,0 +1,252 @@
+package mail
+
+import (
+	"agora/src/db/dbtest"
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSMTPServer accepts mails on a local port and answers the end of
+// each message with the next reply, the last reply repeats. Accepted and
+// rejected messages are both passed on to the returned channel.
+func startSMTPServer(t *testing.T, replies ...string) (port string, messages <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reply := replies[0]
+			if len(replies) > 1 {
+				replies = replies[1:]
+			}
+			serveSMTP(conn, reply, received)
+		}
+	}()
+
+	return fmt.Sprint(listener.Addr().(*net.TCPAddr).Port), received
+}
+
+// serveSMTP speaks just enough SMTP for net/smtp.SendMail
+func serveSMTP(conn net.Conn, dataReply string, received chan<- string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 test server\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		verb, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			fmt.Fprint(conn, "250 test server\r\n")
+		case "DATA":
+			fmt.Fprint(conn, "354 end with .\r\n")
+			var message strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				message.WriteString(line)
+			}
+			received <- message.String()
+			fmt.Fprint(conn, dataReply+"\r\n")
+		case "QUIT":
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+func newTestMailHandler(t *testing.T, port string) *MailHandler {
+	mh := &MailHandler{
+		db:     dbtest.Open(t),
+		config: Config{Host: "127.0.0.1", Port: port, From: "Agora <agora@example.com>"},
+		stop:   make(chan struct{}),
+	}
+	dbtest.Migrate(t, mh.CreateDBTable)
+	return mh
+}
+
+type queueState struct {
+	Sent      bool
+	Attempts  int
+	LastError string
+	// RetryIn is the number of seconds until the next attempt
+	RetryIn int
+}
+
+func queryQueueState(t *testing.T, mh *MailHandler) queueState {
+	t.Helper()
+
+	var state queueState
+	err := mh.db.QueryRow(
+		`SELECT sent_at IS NOT NULL, attempts, coalesce(last_error, ''),
+			strftime('%s', next_attempt_at) - strftime('%s', 'now')
+		 FROM mail_queue`,
+	).Scan(&state.Sent, &state.Attempts, &state.LastError, &state.RetryIn)
+	if err != nil {
+		t.Fatalf("could not query mail queue: %v", err)
+	}
+	return state
+}
+
+// skipBackoff makes a failed mail due as if its retry time had passed
+func skipBackoff(t *testing.T, mh *MailHandler) {
+	t.Helper()
+	if _, err := mh.db.Exec(`UPDATE mail_queue SET next_attempt_at = CURRENT_TIMESTAMP`); err != nil {
+		t.Fatalf("could not update mail queue: %v", err)
+	}
+}
+
+func TestTemporaryFailureIsRetriedWithBackoff(t *testing.T) {
+	port, messages := startSMTPServer(t, "451 try again later", "451 try again later", "250 queued")
+	mh := newTestMailHandler(t, port)
+
+	if err := mh.Enqueue(Message{To: "bob@example.com", Subject: "New comment", Body: "Hi Bob"}); err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+
+	mh.sendDueMessages()
+	<-messages
+	state := queryQueueState(t, mh)
+	if state.Sent || state.Attempts != 1 || !strings.Contains(state.LastError, "451") {
+		t.Fatalf("first failure not recorded: %+v", state)
+	}
+	if state.RetryIn < 55 || state.RetryIn > 60 {
+		t.Errorf("first retry should be in a minute, got %ds", state.RetryIn)
+	}
+
+	// nothing is sent before the backoff has passed
+	mh.sendDueMessages()
+	select {
+	case <-messages:
+		t.Fatal("mail was resent before its backoff passed")
+	default:
+	}
+
+	skipBackoff(t, mh)
+	mh.sendDueMessages()
+	<-messages
+	state = queryQueueState(t, mh)
+	if state.Sent || state.Attempts != 2 {
+		t.Fatalf("second failure not recorded: %+v", state)
+	}
+	if state.RetryIn < 115 || state.RetryIn > 120 {
+		t.Errorf("second retry should be in two minutes, got %ds", state.RetryIn)
+	}
+
+	skipBackoff(t, mh)
+	mh.sendDueMessages()
+	message := <-messages
+	state = queryQueueState(t, mh)
+	if !state.Sent || state.Attempts != 3 {
+		t.Fatalf("mail should be sent on the third attempt: %+v", state)
+	}
+	if !strings.Contains(message, "To: bob@example.com\r\n") || !strings.HasSuffix(message, "\r\nHi Bob\r\n") {
+		t.Errorf("the retry should send the queued mail, got %q", message)
+	}
+}
+
+func TestPermanentFailureGivesUpAfterMaxAttempts(t *testing.T) {
+	port, messages := startSMTPServer(t, "550 no such user")
+	mh := newTestMailHandler(t, port)
+
+	if err := mh.Enqueue(Message{To: "gone@example.com", Subject: "Digest", Body: "Top posts"}); err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+
+	for attempt := 1; attempt <= maxAttempts+2; attempt++ {
+		mh.sendDueMessages()
+		skipBackoff(t, mh)
+	}
+
+	if sent := len(messages); sent != maxAttempts {
+		t.Errorf("expected %d attempts before giving up, got %d", maxAttempts, sent)
+	}
+	state := queryQueueState(t, mh)
+	if state.Sent || state.Attempts != maxAttempts || !strings.Contains(state.LastError, "550") {
+		t.Errorf("given up mail should keep its last error: %+v", state)
+	}
+
+	due, err := mh.queryDueMessages()
+	if err != nil {
+		t.Fatalf("could not query due mails: %v", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("mail should not be due after %d attempts", maxAttempts)
+	}
+}
+
+func TestUnreachableServerCountsAsAttempt(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	port := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	mh := newTestMailHandler(t, port)
+	if err := mh.Enqueue(Message{To: "bob@example.com", Subject: "Hello", Body: "Hi"}); err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+
+	mh.sendDueMessages()
+
+	state := queryQueueState(t, mh)
+	if state.Sent || state.Attempts != 1 || state.LastError == "" {
+		t.Errorf("connection error should be retried like a rejection: %+v", state)
+	}
+}
+
+func TestFormatEncodesSubjectAndLineEndings(t *testing.T) {
+	mh := &MailHandler{config: Config{From: "Agora <agora@example.com>"}}
+
+	formatted := string(mh.format(Message{
+		To:      "bob@example.com",
+		Subject: "Grüße",
+		Body:    "first\nsecond\r\nthird",
+	}))
+
+	headers, body, _ := strings.Cut(formatted, "\r\n\r\n")
+	if !strings.Contains(headers, "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\r\n") {
+		t.Errorf("subject should be Q-encoded:\n%s", headers)
+	}
+	if !strings.Contains(headers, "@example.com>\r\n") {
+		t.Errorf("Message-ID should use the domain of the sender:\n%s", headers)
+	}
+	if body != "first\r\nsecond\r\nthird\r\n" {
+		t.Errorf("all body lines should end with CRLF, got %q", body)
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:           time.Minute,
+		2:           2 * time.Minute,
+		maxAttempts: 32 * time.Minute,
+	} {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
-import "agora/src/server"
+import (
+	"agora/src/cli"
+	"os"
+)
 
 func main() {
-	server.Run()
+	os.Exit(cli.Run(os.Args[1:]))
 }
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Handler serves the metrics, with a token only
+// to requests that send it as bearer token
+func Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			sent, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				slog.WarnContext(r.Context(), "rejected metrics request without valid token", "remoteAddr", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Missing or invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		WriteAll(w)
+	})
+}
@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is written in the Prometheus text format
+type metric interface {
+	write(w io.Writer)
+}
+
+// registry holds every metric in the order it was created,
+// metrics are created once as package variables
+var registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// WriteAll writes every metric in the Prometheus text format
+func WriteAll(w io.Writer) {
+	registry.mu.Lock()
+	metrics := append([]metric{}, registry.metrics...)
+	registry.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// DefaultBuckets are the upper bounds of durations in seconds
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter counts per combination of label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: map[string]*counterSeries{},
+	}
+	register(c)
+	return c
+}
+
+// Inc adds one, the label values are in the order of the labels
+func (c *Counter) Inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, found := c.series[key]
+	if !found {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[key] = s
+	}
+	s.value++
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.name, c.labels, s.labelValues, "", "", s.value)
+	}
+}
+
+// Histogram counts observations in buckets per combination of label values
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, found := h.series[key]
+	if !found {
+		s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", formatValue(bound), float64(s.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// Gauge is a single value that goes up and down
+type Gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+	set   bool
+}
+
+func NewGauge(name string, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+	g.set = true
+}
+
+// write leaves out gauges that were never set,
+// e.g. the time of a run that did not happen yet
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.set {
+		return
+	}
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", g.value)
+}
+
+// GaugeFunc is a gauge read when the metrics are written,
+// it is left out if reading fails
+type GaugeFunc struct {
+	name string
+	help string
+	read func() (float64, error)
+}
+
+func NewGaugeFunc(name string, help string, read func() (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, read: read}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	value, err := g.read()
+	if err != nil {
+		return
+	}
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", value)
+}
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	io.WriteString(w, "# HELP "+name+" "+strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)+"\n")
+	io.WriteString(w, "# TYPE "+name+" "+kind+"\n")
+}
+
+// writeSample writes one line, extraLabel is e.g. the le of a bucket
+func writeSample(w io.Writer, name string, labels []string, labelValues []string, extraLabel string, extraValue string, value float64) {
+	var pairs []string
+	for i, label := range labels {
+		labelValue := ""
+		if i < len(labelValues) {
+			labelValue = labelValues[i]
+		}
+		pairs = append(pairs, label+`="`+escapeLabelValue(labelValue)+`"`)
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+`="`+extraValue+`"`)
+	}
+
+	line := name
+	if len(pairs) > 0 {
+		line += "{" + strings.Join(pairs, ",") + "}"
+	}
+	io.WriteString(w, line+" "+formatValue(value)+"\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
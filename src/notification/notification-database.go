@@ -0,0 +1,159 @@
+package notification
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fk_recipient_id TEXT NOT NULL,
+		fk_actor_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		fk_post_id INTEGER,
+		fk_comment_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		read_at DATETIME,
+
+		CONSTRAINT "fk_recipient_id" FOREIGN KEY("fk_recipient_id") REFERENCES users(id),
+		CONSTRAINT "fk_actor_id" FOREIGN KEY("fk_actor_id") REFERENCES users(id),
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES posts(id),
+		CONSTRAINT "fk_comment_id" FOREIGN KEY("fk_comment_id") REFERENCES comments(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications(fk_recipient_id, read_at);
+`
+
+func (nh *NotificationHandler) CreateDBTable() error {
+	_, err := nh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating notifications table", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (nh *NotificationHandler) insertNotification(n Notification) error {
+	_, err := nh.db.Exec(
+		`INSERT INTO notifications (fk_recipient_id, fk_actor_id, kind, fk_post_id, fk_comment_id)
+		 VALUES (?, ?, ?, ?, ?)`,
+		n.RecipientID,
+		n.ActorID,
+		n.Kind,
+		n.PostID,
+		n.CommentID,
+	)
+	return err
+}
+
+func (nh *NotificationHandler) QueryUnreadCount(userID string) (int, error) {
+	var count int
+	err := nh.db.QueryRow(
+		`SELECT count(*) FROM notifications WHERE fk_recipient_id = ? AND read_at IS NULL`,
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+func (nh *NotificationHandler) queryNotificationsOfUser(userID string, limit int) ([]NotificationListRecord, error) {
+	rows, err := nh.db.Query(
+		`SELECT n.id, n.kind, n.fk_post_id, n.fk_comment_id, n.created_at, n.read_at IS NOT NULL,
+			n.fk_actor_id, u.name, p.title
+		 FROM notifications n
+		 LEFT JOIN users u ON u.id = n.fk_actor_id
+		 LEFT JOIN posts p ON p.id = n.fk_post_id
+		 WHERE n.fk_recipient_id = ?
+		 ORDER BY n.created_at DESC, n.id DESC
+		 LIMIT ?`,
+		userID,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []NotificationListRecord
+	for rows.Next() {
+		var record NotificationListRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.Kind,
+			&record.PostID,
+			&record.CommentID,
+			&record.CreatedAt,
+			&record.Read,
+			&record.ActorID,
+			&record.FActorName,
+			&record.FPostTitle,
+		)
+		if err != nil {
+			slog.Error("could not scan notification", "err", err)
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+type NotificationListRecord struct {
+	ID         int
+	Kind       string
+	PostID     int
+	CommentID  int64
+	CreatedAt  string
+	Read       bool
+	ActorID    string
+	FActorName sql.NullString
+	FPostTitle sql.NullString
+}
+
+// markAsRead marks one notification, or all of them if id is 0
+func (nh *NotificationHandler) markAsRead(userID string, id int) error {
+	_, err := nh.db.Exec(
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		 WHERE fk_recipient_id = ? AND read_at IS NULL AND (? = 0 OR id = ?)`,
+		userID,
+		id,
+		id,
+	)
+	return err
+}
+
+func (nh *NotificationHandler) queryPostAuthor(postID int) (string, error) {
+	var userID string
+	err := nh.db.QueryRow(`SELECT fk_user_id FROM posts WHERE id = ?`, postID).Scan(&userID)
+	return userID, err
+}
+
+func (nh *NotificationHandler) queryCommentAuthor(commentID int64) (string, error) {
+	var userID string
+	err := nh.db.QueryRow(`SELECT fk_user_id FROM comments WHERE id = ?`, commentID).Scan(&userID)
+	return userID, err
+}
+
+func (nh *NotificationHandler) queryUserIDsByHandle(handle string) ([]string, error) {
+	rows, err := nh.db.Query(
+		`SELECT id FROM users
+		 WHERE lower(replace(name, ' ', '')) = ?
+		 OR lower(substr(email, 1, instr(email, '@') - 1)) = ?`,
+		handle,
+		handle,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
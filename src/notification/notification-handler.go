@@ -0,0 +1,92 @@
+package notification
+
+import (
+	"agora/src/db"
+	"agora/src/event"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+type NotificationHandler struct {
+	db *db.DB
+}
+
+func NewNotificationHandler(db *db.DB, bus *event.Bus) *NotificationHandler {
+	nh := &NotificationHandler{db: db}
+	bus.Subscribe(event.CommentCreated, nh.onCommentCreated)
+	return nh
+}
+
+// onCommentCreated notifies the author of the replied comment,
+// the author of the post and everyone mentioned, each at most once
+// and never the person who wrote the comment
+func (nh *NotificationHandler) onCommentCreated(e event.Event) {
+	payload, ok := e.Payload.(event.CommentCreatedPayload)
+	if !ok {
+		slog.Error("unexpected payload", "topic", e.Topic, "payload", e.Payload)
+		return
+	}
+
+	notified := map[string]bool{payload.UserID: true}
+	notify := func(recipientID string, kind string) {
+		if recipientID == "" || notified[recipientID] {
+			return
+		}
+		notified[recipientID] = true
+
+		err := nh.insertNotification(Notification{
+			RecipientID: recipientID,
+			ActorID:     payload.UserID,
+			Kind:        kind,
+			PostID:      payload.PostID,
+			CommentID:   payload.CommentID,
+		})
+		if err != nil {
+			slog.Error("could not create notification", "recipientID", recipientID, "kind", kind, "err", err)
+		}
+	}
+
+	if payload.ParentID != 0 {
+		parentAuthorID, err := nh.queryCommentAuthor(payload.ParentID)
+		if err != nil {
+			slog.Error("could not find author of parent comment", "commentID", payload.ParentID, "err", err)
+		}
+		notify(parentAuthorID, KindReply)
+	}
+
+	postAuthorID, err := nh.queryPostAuthor(payload.PostID)
+	if err != nil {
+		slog.Error("could not find author of post", "postID", payload.PostID, "err", err)
+	}
+	notify(postAuthorID, KindCommentOnPost)
+
+	for _, handle := range ParseMentions(payload.Text) {
+		userIDs, err := nh.queryUserIDsByHandle(handle)
+		if err != nil {
+			slog.Error("could not resolve mention", "handle", handle, "err", err)
+			continue
+		}
+		for _, userID := range userIDs {
+			notify(userID, KindMention)
+		}
+	}
+}
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_.\-]+)`)
+
+// ParseMentions returns the distinct handles mentioned with @handle.
+// A handle is the display name without spaces or the local part of the email.
+func ParseMentions(text string) []string {
+	var handles []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		if handle == "" || seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		handles = append(handles, handle)
+	}
+	return handles
+}
@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/user"
+	"agora/src/x/date"
+	"agora/src/x/redirect"
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed notification-list.html
+var notificationListTemplate string
+
+const maxNotificationsOnPage = 100
+
+func (nh *NotificationHandler) NotificationListGETHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	records, err := nh.queryNotificationsOfUser(user.ID, maxNotificationsOnPage)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query notifications", "userID", user.ID, "err", err)
+		http.Error(w, "Could not retrieve notifications", http.StatusInternalServerError)
+		return
+	}
+
+	var items []NotificationListItem
+	for _, record := range records {
+		items = append(items, NotificationListItem{
+			ID:        record.ID,
+			Kind:      record.Kind,
+			Link:      "/posts/" + strconv.Itoa(record.PostID) + "/#comment-" + strconv.FormatInt(record.CommentID, 10),
+			ActorID:   record.ActorID,
+			ActorName: record.FActorName.String,
+			PostTitle: record.FPostTitle.String,
+			CreatedAt: date.FormatDate(record.CreatedAt),
+			Read:      record.Read,
+		})
+	}
+
+	render.RenderTemplate(
+		w,
+		"notification-list.html",
+		&render.Page{
+			Title: "Notifications",
+			Data: struct {
+				Notifications []NotificationListItem
+			}{
+				Notifications: items,
+			},
+		},
+		r.Context(),
+		notificationListTemplate,
+	)
+}
+
+type NotificationListItem struct {
+	ID        int
+	Kind      string
+	Link      string
+	ActorID   string
+	ActorName string
+	PostTitle string
+	CreatedAt string
+	Read      bool
+}
+
+// NotificationReadPOSTHandler marks a notification as read and
+// continues to what it is about, the form is the notification's link
+func (nh *NotificationHandler) NotificationReadPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := nh.markAsRead(user.ID, id); err != nil {
+		slog.ErrorContext(r.Context(), "could not mark notification as read", "id", id, "userID", user.ID, "err", err)
+		http.Error(w, "Could not mark notification as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirect.ReturnTo(r, "/notifications"), http.StatusSeeOther)
+}
+
+func (nh *NotificationHandler) NotificationReadAllPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	if err := nh.markAsRead(user.ID, 0); err != nil {
+		slog.ErrorContext(r.Context(), "could not mark notifications as read", "userID", user.ID, "err", err)
+		http.Error(w, "Could not mark notifications as read", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// Middleware puts the unread count into the context for the header badge
+func (nh *NotificationHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok := r.Context().Value("user").(user.User)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		count, err := nh.QueryUnreadCount(user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not count unread notifications", "userID", user.ID, "err", err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(render.WithUnreadNotifications(r.Context(), count)))
+	})
+}
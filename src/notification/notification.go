@@ -0,0 +1,16 @@
+package notification
+
+const (
+	KindCommentOnPost = "comment_on_post"
+	KindReply         = "reply"
+	KindMention       = "mention"
+)
+
+type Notification struct {
+	ID          int
+	RecipientID string
+	ActorID     string
+	Kind        string
+	PostID      int
+	CommentID   int64
+}
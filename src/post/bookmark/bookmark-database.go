@@ -0,0 +1,69 @@
+package bookmark
+
+import (
+	"log/slog"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS bookmarks (
+		fk_user_id TEXT NOT NULL,
+		fk_post_id INTEGER NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(fk_user_id, fk_post_id),
+		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id),
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES posts(id)
+	);
+`
+
+func (bh *BookmarkHandler) CreateDBTable() error {
+	_, err := bh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating bookmarks table", "err", err)
+		return err
+	}
+	return nil
+}
+
+// toggleBookmark saves the post for the user or removes the
+// existing bookmark and reports whether the post is saved afterwards
+func (bh *BookmarkHandler) toggleBookmark(userID string, postID int) (bool, error) {
+	result, err := bh.db.Exec(
+		`DELETE FROM bookmarks WHERE fk_user_id = ? AND fk_post_id = ?`,
+		userID,
+		postID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if removed > 0 {
+		return false, nil
+	}
+
+	_, err = bh.db.Exec(
+		`INSERT INTO bookmarks (fk_user_id, fk_post_id) VALUES (?, ?)`,
+		userID,
+		postID,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (bh *BookmarkHandler) updateNote(userID string, postID int, note string) error {
+	_, err := bh.db.Exec(
+		`UPDATE bookmarks SET note = ? WHERE fk_user_id = ? AND fk_post_id = ?`,
+		note,
+		userID,
+		postID,
+	)
+	return err
+}
@@ -0,0 +1,24 @@
+package bookmark
+
+import (
+	"agora/src/db"
+)
+
+type BookmarkHandler struct {
+	db *db.DB
+}
+
+func NewBookmarkHandler(db *db.DB) *BookmarkHandler {
+	return &BookmarkHandler{db: db}
+}
+
+func (bh *BookmarkHandler) RemoveAllBookmarksOfPost(postID int) error {
+	_, err := bh.db.Exec(
+		`DELETE FROM bookmarks WHERE fk_post_id = ?`,
+		postID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package bookmark
+
+import (
+	"agora/src/server/auth"
+	"agora/src/validation"
+	"agora/src/x/redirect"
+	"agora/src/x/sanitize"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (bh *BookmarkHandler) BookmarkTogglePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := bh.toggleBookmark(user.ID, postID); err != nil {
+		slog.ErrorContext(r.Context(), "could not toggle bookmark", "postID", postID, "userID", user.ID, "err", err)
+		http.Error(w, "Could not save post", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirect.ReturnTo(r, "/saved"), http.StatusSeeOther)
+}
+
+func (bh *BookmarkHandler) BookmarkNotePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	note := sanitize.Sanitize(r.FormValue("note"))
+	errs := validation.Errors{}
+	errs.Note("note", note)
+	if !errs.Valid() {
+		http.Redirect(w, r, "/saved?error="+ErrorNoteTooLong, http.StatusSeeOther)
+		return
+	}
+
+	if err := bh.updateNote(user.ID, postID, note); err != nil {
+		slog.ErrorContext(r.Context(), "could not update bookmark note", "postID", postID, "userID", user.ID, "err", err)
+		http.Error(w, "Could not save note", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/saved#post-"+strconv.Itoa(postID), http.StatusSeeOther)
+}
+
+// ErrorNoteTooLong is the error code the saved list is redirected with,
+// the list shows the message of the code instead of text from the URL
+const ErrorNoteTooLong = "note-too-long"
+
+var errorMessages = map[string]string{
+	ErrorNoteTooLong: "Note is too long",
+}
+
+// ErrorMessage is empty for unknown codes
+func ErrorMessage(code string) string {
+	return errorMessages[code]
+}
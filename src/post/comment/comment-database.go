@@ -1,7 +1,9 @@
 package comment
 
 import (
-	"agora/src/log"
+	"agora/src/event"
+	"database/sql"
+	"log/slog"
 )
 
 const TABLE_QUERY = `
@@ -11,6 +13,7 @@ const TABLE_QUERY = `
 		"created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
 		"fk_post_id" INTEGER,
 		"fk_user_id" TEXT NOT NULL,
+		"fk_parent_id" INTEGER,
 
 		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES posts(id),
 		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id),
@@ -21,39 +24,77 @@ const TABLE_QUERY = `
 func (ch *CommentHandler) CreateDBTable() error {
 	_, err := ch.db.Exec(TABLE_QUERY)
 	if err != nil {
-		log.Error.Printf("Error creating posts table: %v", err)
+		slog.Error("error creating comments table", "err", err)
+		return err
+	}
+
+	if err := ch.db.AddColumnIfMissing("comments", "fk_parent_id", "INTEGER"); err != nil {
+		slog.Error("error adding parent column to comments table", "err", err)
 		return err
 	}
 	return nil
 }
 
 func (ch *CommentHandler) InsertNewComment(c CommentInsertRecord) (int64, error) {
-	// Insert a new post into the database
+	parentID := sql.NullInt64{Int64: c.ParentID, Valid: c.ParentID != 0}
+
 	result, err := ch.db.Exec(
-		`INSERT INTO comments (text, fk_post_id, fk_user_id) VALUES (?, ?, ?)`,
+		`INSERT INTO comments (text, fk_post_id, fk_user_id, fk_parent_id) VALUES (?, ?, ?, ?)`,
 		c.Text,
 		c.PostID,
 		c.UserID,
+		parentID,
 	)
 	if err != nil {
-		log.Error.Printf("Error inserting new comment: %v", err)
+		slog.Error("error inserting new comment", "err", err)
+		return 0, err
+	}
+
+	commentID, err := result.LastInsertId()
+	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+
+	ch.bus.Publish(event.CommentCreated, event.CommentCreatedPayload{
+		CommentID: commentID,
+		PostID:    c.PostID,
+		ParentID:  c.ParentID,
+		UserID:    c.UserID,
+		Text:      c.Text,
+	})
+
+	return commentID, nil
 }
 
 type CommentInsertRecord struct {
 	Text   string
 	PostID int
 	UserID string
+	// ParentID is the comment this one replies to, 0 for top level comments
+	ParentID int64
+}
+
+// CommentBelongsToPost is used to make sure replies stay within their post
+func (ch *CommentHandler) CommentBelongsToPost(commentID int64, postID int) (bool, error) {
+	var belongs bool
+	err := ch.db.QueryRow(
+		`SELECT count(*) > 0 FROM comments WHERE id = ? AND fk_post_id = ?`,
+		commentID,
+		postID,
+	).Scan(&belongs)
+	return belongs, err
 }
 
 func (ch *CommentHandler) QueryAllCommentyByPostID(postID int) ([]CommentListRecord, error) {
 	rows, err := ch.db.Query(
-		`SELECT c.id, c.text, c.created_at, u.name
+		`SELECT c.id, c.text, c.created_at, c.fk_user_id, u.name,
+			c.fk_parent_id, pu.name
 		 FROM comments c
 		 LEFT JOIN users u ON u.id = c.fk_user_id
-		 WHERE c.fk_post_id = ?`,
+		 LEFT JOIN comments pc ON pc.id = c.fk_parent_id
+		 LEFT JOIN users pu ON pu.id = pc.fk_user_id
+		 WHERE c.fk_post_id = ?
+		 ORDER BY c.created_at ASC, c.id ASC`,
 		postID,
 	)
 	if err != nil {
@@ -69,10 +110,13 @@ func (ch *CommentHandler) QueryAllCommentyByPostID(postID int) ([]CommentListRec
 			&record.ID,
 			&record.Text,
 			&record.CreatedAt,
+			&record.UserID,
 			&record.UserName,
+			&record.ParentID,
+			&record.ParentUserName,
 		)
 		if err != nil {
-			log.Error.Printf("msg='could not scan row' err='%s'\n", err)
+			slog.Error("could not scan row", "err", err)
 			return nil, err
 		}
 
@@ -89,4 +133,7 @@ type CommentListRecord struct {
 	UserID    string
 	CreatedAt string
 	UserName  string
+
+	ParentID       sql.NullInt64
+	ParentUserName sql.NullString
 }
@@ -2,14 +2,19 @@ package comment
 
 import (
 	"agora/src/db"
+	"agora/src/event"
 )
 
 type CommentHandler struct {
-	db *db.DB
+	db  *db.DB
+	bus *event.Bus
 }
 
-func NewCommentHandler(db *db.DB) *CommentHandler {
-	return &CommentHandler{db: db}
+func NewCommentHandler(db *db.DB, bus *event.Bus) *CommentHandler {
+	return &CommentHandler{
+		db:  db,
+		bus: bus,
+	}
 }
 
 func (ch *CommentHandler) RemoveAllCommentsOfPost(postID int) error {
@@ -0,0 +1,230 @@
+package poll
+
+import (
+	"agora/src/x/date"
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+// A ballot is the vote of one user on a poll, UNIQUE makes sure
+// there is only one per user. With multiple choice a ballot has several choices.
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS polls (
+		fk_post_id INTEGER PRIMARY KEY,
+		multiple_choice BOOLEAN NOT NULL DEFAULT 0,
+		closes_at DATETIME,
+
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES posts(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_options (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fk_post_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		position INTEGER NOT NULL,
+
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES polls(fk_post_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_ballots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fk_post_id INTEGER NOT NULL,
+		fk_user_id TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+
+		UNIQUE(fk_post_id, fk_user_id),
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES polls(fk_post_id),
+		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS poll_choices (
+		fk_ballot_id INTEGER NOT NULL,
+		fk_option_id INTEGER NOT NULL,
+
+		UNIQUE(fk_ballot_id, fk_option_id),
+		CONSTRAINT "fk_ballot_id" FOREIGN KEY("fk_ballot_id") REFERENCES poll_ballots(id),
+		CONSTRAINT "fk_option_id" FOREIGN KEY("fk_option_id") REFERENCES poll_options(id)
+	);
+`
+
+var ErrPollNotFound = errors.New("poll not found")
+var ErrPollClosed = errors.New("poll is closed")
+var ErrAlreadyVoted = errors.New("user already voted")
+var ErrInvalidChoice = errors.New("invalid choice")
+var ErrPostLocked = errors.New("post is locked")
+
+func (plh *PollHandler) CreateDBTable() error {
+	_, err := plh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating poll tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+// CreatePoll runs in the transaction the post is created in
+func (plh *PollHandler) CreatePoll(tx *sql.Tx, postID int64, poll NewPoll) error {
+	closesAt := sql.NullString{}
+	if !poll.ClosesAt.IsZero() {
+		closesAt = sql.NullString{String: poll.ClosesAt.UTC().Format(date.SQLite), Valid: true}
+	}
+
+	_, err := tx.Exec(
+		`INSERT INTO polls (fk_post_id, multiple_choice, closes_at) VALUES (?, ?, ?)`,
+		postID,
+		poll.MultipleChoice,
+		closesAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for position, option := range poll.Options {
+		_, err := tx.Exec(
+			`INSERT INTO poll_options (fk_post_id, text, position) VALUES (?, ?, ?)`,
+			postID,
+			option,
+			position,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueryPoll returns false if the post has no poll
+func (plh *PollHandler) QueryPoll(postID int, userID string) (Poll, bool, error) {
+	poll := Poll{PostID: postID}
+	var closesAt sql.NullString
+	err := plh.db.QueryRow(
+		`SELECT
+			multiple_choice,
+			closes_at,
+			closes_at IS NOT NULL AND closes_at <= CURRENT_TIMESTAMP,
+			(SELECT count(*) FROM poll_ballots b WHERE b.fk_post_id = p.fk_post_id),
+			(SELECT count(*) > 0 FROM poll_ballots b WHERE b.fk_post_id = p.fk_post_id AND b.fk_user_id = ?)
+		 FROM polls p
+		 WHERE p.fk_post_id = ?`,
+		userID,
+		postID,
+	).Scan(
+		&poll.MultipleChoice,
+		&closesAt,
+		&poll.Closed,
+		&poll.NumberOfVoters,
+		&poll.UserVoted,
+	)
+	if err == sql.ErrNoRows {
+		return Poll{}, false, nil
+	}
+	if err != nil {
+		return Poll{}, false, err
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = date.FormatDate(closesAt.String)
+	}
+
+	rows, err := plh.db.Query(
+		`SELECT
+			o.id, o.text,
+			(SELECT count(*) FROM poll_choices c WHERE c.fk_option_id = o.id),
+			EXISTS (
+				SELECT 1 FROM poll_choices c
+				JOIN poll_ballots b ON b.id = c.fk_ballot_id
+				WHERE c.fk_option_id = o.id AND b.fk_user_id = ?
+			)
+		 FROM poll_options o
+		 WHERE o.fk_post_id = ?
+		 ORDER BY o.position`,
+		userID,
+		postID,
+	)
+	if err != nil {
+		return Poll{}, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var option Option
+		if err := rows.Scan(&option.ID, &option.Text, &option.Votes, &option.Chosen); err != nil {
+			return Poll{}, false, err
+		}
+		if poll.NumberOfVoters > 0 {
+			option.Percent = option.Votes * 100 / poll.NumberOfVoters
+		}
+		poll.Options = append(poll.Options, option)
+	}
+
+	return poll, true, nil
+}
+
+func (plh *PollHandler) vote(postID int, userID string, optionIDs []int64) error {
+	tx, err := plh.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var multipleChoice, closed, locked bool
+	err = tx.QueryRow(
+		`SELECT pl.multiple_choice, pl.closes_at IS NOT NULL AND pl.closes_at <= CURRENT_TIMESTAMP, p.locked
+		 FROM polls pl
+		 JOIN posts p ON p.id = pl.fk_post_id
+		 WHERE pl.fk_post_id = ?`,
+		postID,
+	).Scan(&multipleChoice, &closed, &locked)
+	if err == sql.ErrNoRows {
+		return ErrPollNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if closed {
+		return ErrPollClosed
+	}
+	if locked {
+		return ErrPostLocked
+	}
+	if len(optionIDs) == 0 || (!multipleChoice && len(optionIDs) > 1) {
+		return ErrInvalidChoice
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO poll_ballots (fk_post_id, fk_user_id) VALUES (?, ?)
+		 ON CONFLICT(fk_post_id, fk_user_id) DO NOTHING`,
+		postID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return ErrAlreadyVoted
+	}
+	ballotID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, optionID := range optionIDs {
+		// the select makes sure the option belongs to this poll
+		result, err := tx.Exec(
+			`INSERT OR IGNORE INTO poll_choices (fk_ballot_id, fk_option_id)
+			 SELECT ?, id FROM poll_options WHERE id = ? AND fk_post_id = ?`,
+			ballotID,
+			optionID,
+			postID,
+		)
+		if err != nil {
+			return err
+		}
+		if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+			return ErrInvalidChoice
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,35 @@
+package poll
+
+import (
+	"agora/src/db"
+)
+
+type PollHandler struct {
+	db *db.DB
+}
+
+func NewPollHandler(db *db.DB) *PollHandler {
+	return &PollHandler{db: db}
+}
+
+func (plh *PollHandler) RemovePollOfPost(postID int) error {
+	tx, err := plh.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM poll_choices WHERE fk_ballot_id IN (SELECT id FROM poll_ballots WHERE fk_post_id = ?)`,
+		`DELETE FROM poll_ballots WHERE fk_post_id = ?`,
+		`DELETE FROM poll_options WHERE fk_post_id = ?`,
+		`DELETE FROM polls WHERE fk_post_id = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, postID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
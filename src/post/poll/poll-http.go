@@ -0,0 +1,68 @@
+package poll
+
+import (
+	"agora/src/server/auth"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func (plh *PollHandler) PollVotePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "User not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	var optionIDs []int64
+	for _, value := range r.Form["option"] {
+		optionID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid option", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(optionIDs, optionID) {
+			optionIDs = append(optionIDs, optionID)
+		}
+	}
+
+	err = plh.vote(postID, user.ID, optionIDs)
+	switch err {
+	case nil:
+	case ErrPollNotFound:
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	case ErrPollClosed:
+		http.Error(w, "This poll is closed", http.StatusConflict)
+		return
+	case ErrPostLocked:
+		http.Error(w, "This post is locked by a moderator, new votes are not allowed", http.StatusForbidden)
+		return
+	case ErrAlreadyVoted:
+		http.Error(w, "You have already voted in this poll", http.StatusConflict)
+		return
+	case ErrInvalidChoice:
+		http.Error(w, "Choose one of the options", http.StatusBadRequest)
+		return
+	default:
+		slog.ErrorContext(r.Context(), "could not vote in poll", "postID", postID, "userID", user.ID, "err", err)
+		http.Error(w, "Could not vote", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/posts/"+strconv.Itoa(postID)+"#poll", http.StatusSeeOther)
+}
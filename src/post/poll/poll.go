@@ -0,0 +1,54 @@
+package poll
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+type Poll struct {
+	PostID         int
+	MultipleChoice bool
+	// ClosesAt is empty for polls without an end
+	ClosesAt       string
+	Closed         bool
+	NumberOfVoters int
+	UserVoted      bool
+	Options        []Option
+}
+
+// ShowResults hides the results until the user voted,
+// so the first votes do not steer the rest
+func (p Poll) ShowResults() bool {
+	return p.UserVoted || p.Closed
+}
+
+type Option struct {
+	ID    int64
+	Text  string
+	Votes int
+	// Percent of the voters that chose this option
+	Percent int
+	Chosen  bool
+}
+
+// NewPoll is created together with its post
+type NewPoll struct {
+	Options        []string
+	MultipleChoice bool
+	// ClosesAt is the zero time for polls without an end
+	ClosesAt time.Time
+}
+
+// ParseOptions reads one option per line and drops empty lines and duplicates
+func ParseOptions(text string) []string {
+	var options []string
+	for _, line := range strings.Split(text, "\n") {
+		option := strings.TrimSpace(line)
+		if option == "" || slices.Contains(options, option) {
+			continue
+		}
+		options = append(options, option)
+	}
+	return options
+}
@@ -1,8 +1,16 @@
 package post
 
 import (
-	"agora/src/log"
+	"agora/src/event"
+	"agora/src/post/poll"
+	"agora/src/x/canonical"
+	"agora/src/x/date"
 	"database/sql"
+	"errors"
+	"html"
+	"log/slog"
+	"strings"
+	"time"
 )
 
 // type PostRecord struct {
@@ -24,81 +32,223 @@ type PostRecord struct {
 	Description string
 	CreatedAt   string
 	Rank        int
+	Type        PostType
+	// ExpiresAt is only set for announcements
+	ExpiresAt sql.NullString
+	// Pinned posts are listed above the ranked ones
+	Pinned bool
+	// Locked posts take no new comments or votes
+	Locked bool
 }
 
 const TABLE_QUERY = `CREATE TABLE IF NOT EXISTS posts (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		title TEXT NOT NULL,
-		url TEXT UNIQUE,
+		url TEXT,
+		url_canonical TEXT,
 		description TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		fk_user_id TEXT NOT NULL,
 		rank INT DEFAULT 0,
+		type TEXT NOT NULL DEFAULT 'link',
+		expires_at DATETIME,
+		pinned BOOLEAN NOT NULL DEFAULT 0,
+		locked BOOLEAN NOT NULL DEFAULT 0,
 
 		CONSTRAINT "fk_user_id" FOREIGN KEY("fk_user_id") REFERENCES users(id)
 	);
+	CREATE INDEX IF NOT EXISTS idx_posts_url ON posts(url);
 	`
 
+var ErrPostNotFound = errors.New("post not found")
+
 func (ph *PostHandler) CreateDBTable() error {
 	// Create the posts table if it doesn't exist
 	_, err := ph.db.Exec(TABLE_QUERY)
 	if err != nil {
-		log.Error.Printf("Error creating posts table: %v", err)
+		slog.Error("error creating posts table", "err", err)
+		return err
+	}
+
+	if err := ph.migrateURLNotUnique(); err != nil {
+		slog.Error("error migrating posts table", "err", err)
+		return err
+	}
+
+	if err := ph.migrateCanonicalURL(); err != nil {
+		slog.Error("error adding canonical urls to posts table", "err", err)
+		return err
+	}
+
+	if err := ph.migratePostTypes(); err != nil {
+		slog.Error("error adding post types to posts table", "err", err)
+		return err
+	}
+
+	if err := ph.db.AddColumnIfMissing("posts", "pinned", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		slog.Error("error adding pinned to posts table", "err", err)
+		return err
+	}
+	if err := ph.db.AddColumnIfMissing("posts", "locked", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		slog.Error("error adding locked to posts table", "err", err)
 		return err
 	}
 	return nil
 }
 
+// migratePostTypes adds the type columns. Before there were types
+// a post without url was a text post, which is an Ask post now.
+// Link posts always have a url, so running this again changes nothing.
+func (ph *PostHandler) migratePostTypes() error {
+	if err := ph.db.AddColumnIfMissing("posts", "type", "TEXT NOT NULL DEFAULT 'link'"); err != nil {
+		return err
+	}
+	if err := ph.db.AddColumnIfMissing("posts", "expires_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	_, err := ph.db.Exec(
+		`UPDATE posts SET type = ? WHERE type = ? AND (url IS NULL OR url = '')`,
+		TypeAsk,
+		TypeLink,
+	)
+	return err
+}
+
 func (ph *PostHandler) InsertNewPost(record PostNewRecord) (int64, error) {
 	// Insert a new post into the database
-	var url interface{}
+	var url, canonicalURL interface{}
 	if record.URL == "" {
 		url = nil
+		canonicalURL = nil
 	} else {
 		url = record.URL
+		canonicalURL = record.CanonicalURL
+	}
+
+	expiresAt := sql.NullString{}
+	if !record.ExpiresAt.IsZero() {
+		expiresAt = sql.NullString{String: record.ExpiresAt.UTC().Format(date.SQLite), Valid: true}
 	}
 
-	result, err := ph.db.Exec(
+	tx, err := ph.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		`INSERT 
-			INTO posts (title, url, description, fk_user_id) 
-			VALUES (?, ?, ?, ?)
+			INTO posts (title, url, url_canonical, description, fk_user_id, type, expires_at) 
+			VALUES (?, ?, ?, ?, ?, ?, ?)
 		`,
 		record.Title,
 		url,
+		canonicalURL,
 		record.Description,
 		record.UserID,
+		record.Type,
+		expiresAt,
 	)
 
 	if err != nil {
-		log.Error.Printf("Error inserting new post: %v", err)
+		slog.Error("error inserting new post", "err", err)
+		return 0, err
+	}
+
+	postID, err := result.LastInsertId()
+	if err != nil {
 		return 0, err
 	}
 
-	return result.LastInsertId()
+	if err := ph.th.SetTagsOfPost(tx, postID, record.Tags); err != nil {
+		slog.Error("error tagging new post", "err", err)
+		return 0, err
+	}
+
+	if record.Poll != nil {
+		if err := ph.plh.CreatePoll(tx, postID, *record.Poll); err != nil {
+			slog.Error("error creating poll of new post", "err", err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	ph.bus.Publish(event.PostCreated, event.PostCreatedPayload{
+		PostID:      postID,
+		Title:       record.Title,
+		URL:         record.URL,
+		Description: record.Description,
+		UserID:      record.UserID,
+	})
+
+	return postID, nil
+}
+
+// QueryPostByURL returns the newest post with the given canonical url
+// or an empty record if the url was never submitted
+func (ph *PostHandler) QueryPostByURL(canonicalURL string) (PostRecord, error) {
+	var record PostRecord
+	err := ph.db.QueryRow(
+		`SELECT id, title, url, description, created_at, rank
+		 FROM posts
+		 WHERE url_canonical = ?
+		 ORDER BY created_at DESC
+		 LIMIT 1`,
+		canonicalURL,
+	).Scan(
+		&record.ID,
+		&record.Title,
+		&record.URL,
+		&record.Description,
+		&record.CreatedAt,
+		&record.Rank,
+	)
+	if err == sql.ErrNoRows {
+		return PostRecord{}, nil
+	}
+	if err != nil {
+		slog.Error("error querying post by url", "err", err)
+		return PostRecord{}, err
+	}
+
+	return record, nil
 }
 
 type PostNewRecord struct {
-	Title       string
-	URL         string
-	Description string
-	UserID      string
+	Title string
+	URL   string
+	// CanonicalURL is only used to find duplicates, see canonical.URL
+	CanonicalURL string
+	Description  string
+	UserID       string
+	Type         PostType
+	// ExpiresAt is the zero time for posts that do not expire
+	ExpiresAt time.Time
+	Tags      []string
+	// Poll is nil for posts without a poll
+	Poll *poll.NewPoll
 }
 
 func (ph *PostHandler) QueryOnePost(id int) (PostDetailRecord, error) {
 	rows, err := ph.db.Query(
 		`
 		SELECT 
-			p.id, p.title, p.url, p.description, p.created_at, p.rank, p.fk_user_id,
-			u.name,
+			p.id, p.title, p.url, p.description, p.created_at, p.rank, p.type, p.expires_at, p.pinned, p.locked,
+			p.fk_user_id, u.name,
 			(SELECT count(*) FROM comments c WHERE fk_post_id=p.id ) nr_comments,
-			(SELECT count(*) FROM votes v WHERE fk_post_id=p.id ) nr_votes
+			(SELECT count(*) FROM votes v WHERE fk_post_id=p.id ) nr_votes,
+			`+tagsOfPostColumn+`
 		FROM posts p
 		LEFT JOIN users u ON u.id = p.fk_user_id
 		WHERE p.id = ?`,
 		id,
 	)
 	if err != nil {
-		log.Error.Println("Could not query post with id=", id)
+		slog.Error("could not query post", "id", id, "err", err)
 		return PostDetailRecord{}, err
 	}
 	defer rows.Close()
@@ -113,14 +263,19 @@ func (ph *PostHandler) QueryOnePost(id int) (PostDetailRecord, error) {
 			&record.Description,
 			&record.CreatedAt,
 			&record.Rank,
+			&record.Type,
+			&record.ExpiresAt,
+			&record.Pinned,
+			&record.Locked,
 			&record.FUserID,
 			&record.FUserName,
 			&record.FNrOfComments,
 			&record.FNrOfVotes,
+			&record.FTags,
 		)
 
 		if err != nil {
-			log.Error.Printf("Could not scan post: id=%d error=%v", id, err)
+			slog.Error("could not scan post", "id", id, "err", err)
 			return PostDetailRecord{}, err
 		}
 
@@ -131,31 +286,77 @@ func (ph *PostHandler) QueryOnePost(id int) (PostDetailRecord, error) {
 
 }
 
+func (ph *PostHandler) queryUserSaved(postID int, userID string) (bool, error) {
+	var saved bool
+	err := ph.db.QueryRow(
+		`SELECT count(*) > 0 FROM bookmarks WHERE fk_post_id = ? AND fk_user_id = ?`,
+		postID,
+		userID,
+	).Scan(&saved)
+	if err != nil {
+		slog.Error("could not query bookmark", "postID", postID, "userID", userID, "err", err)
+		return false, err
+	}
+	return saved, nil
+}
+
 type PostDetailRecord struct {
 	PostRecord
 	FUserID       string
 	FUserName     string
 	FNrOfComments int
 	FNrOfVotes    int
+	FTags         sql.NullString
 }
 
-func (ph *PostHandler) QueryAllPostsForTheList(userID string) ([]PostListRecord, error) {
+// tagsOfPostColumn selects the comma separated tag names of post p
+const tagsOfPostColumn = `(SELECT group_concat(t.name, ',')
+				FROM post_tags pt
+				JOIN tags t ON t.id = pt.fk_tag_id
+				WHERE pt.fk_post_id = p.id) tags`
+
+// QueryAllPostsForTheList returns the ranked posts narrowed down by filter
+func (ph *PostHandler) QueryAllPostsForTheList(userID string, filter PostListFilter) ([]PostListRecord, error) {
 
 	// Query all posts from the database
 	rows, err := ph.db.Query(`
 		SELECT 
-			p.id, p.title, p.url, p.description, p.created_at, p.rank,
-			u.name,
+			p.id, p.title, p.url, p.description, p.created_at, p.rank, p.type, p.expires_at, p.pinned, p.locked,
+			p.fk_user_id, u.name,
 			(Select count(*) from comments c where fk_post_id=p.id ) nr_comments,
 			(Select count(*) from votes v where fk_post_id=p.id ) nr_votes,
 			(select count(*) > 0 from votes v where v.fk_post_id = p.id and v.fk_user_id = ?) user_voted,
-			p.fk_user_id = ? is_user_author
+			p.fk_user_id = ? is_user_author,
+			b.fk_post_id IS NOT NULL user_saved, b.note, b.created_at,
+			`+tagsOfPostColumn+`
 		FROM posts p
 		LEFT JOIN users u ON u.id = p.fk_user_id
-		ORDER BY p.rank DESC, p.created_at DESC
+		LEFT JOIN bookmarks b ON b.fk_post_id = p.id AND b.fk_user_id = ?
+		WHERE (? = '' OR EXISTS (
+			SELECT 1 FROM post_tags pt
+			JOIN tags t ON t.id = pt.fk_tag_id
+			WHERE pt.fk_post_id = p.id AND t.name = ?
+		))
+		AND (NOT ? OR b.fk_post_id IS NOT NULL)
+		AND (? = '' OR p.type = ?)
+		AND NOT (p.type = 'announcement' AND p.expires_at IS NOT NULL AND p.expires_at <= CURRENT_TIMESTAMP)
+		ORDER BY
+			CASE WHEN ? AND (p.pinned OR p.type = 'announcement') THEN 0 ELSE 1 END,
+			CASE WHEN ? THEN b.created_at END DESC,
+			CASE WHEN ? THEN p.created_at END DESC,
+			p.rank DESC, p.created_at DESC
 	`,
 		userID,
 		userID,
+		userID,
+		filter.Tag,
+		filter.Tag,
+		filter.SavedOnly,
+		filter.Type,
+		filter.Type,
+		filter.PinnedFirst,
+		filter.OrderBySavedAt,
+		filter.OrderByNewest,
 	)
 	if err != nil {
 		return nil, err
@@ -173,14 +374,23 @@ func (ph *PostHandler) QueryAllPostsForTheList(userID string) ([]PostListRecord,
 			&record.Description,
 			&record.CreatedAt,
 			&record.Rank,
+			&record.Type,
+			&record.ExpiresAt,
+			&record.Pinned,
+			&record.Locked,
+			&record.FUserID,
 			&record.FUserName,
 			&record.FNrOfComments,
 			&record.FNrOfVotes,
 			&record.UserVoted,
 			&record.UserIsAuthor,
+			&record.UserSaved,
+			&record.FBookmarkNote,
+			&record.FSavedAt,
+			&record.FTags,
 		)
 		if err != nil {
-			log.Error.Printf("Could not scan post: error=%v rows=%v", err, rows)
+			slog.Error("could not scan post", "err", err)
 			continue
 		}
 
@@ -219,7 +429,7 @@ func (ph *PostHandler) QueryAllPostsForRanking() ([]PostForRanking, error) {
 			&record.FNrOfVotes,
 		)
 		if err != nil {
-			log.Error.Printf("Could not scan post: error=%v rows=%v", err, rows)
+			slog.Error("could not scan post", "err", err)
 			continue
 		}
 
@@ -231,12 +441,32 @@ func (ph *PostHandler) QueryAllPostsForRanking() ([]PostForRanking, error) {
 
 type PostListRecord struct {
 	PostRecord
+	FUserID       string
 	FUserName     string
 	FNrOfComments int
 	FNrOfVotes    int
 	FNUserVoted   int
 	UserVoted     int
 	UserIsAuthor  int
+	UserSaved     int
+	FBookmarkNote sql.NullString
+	FSavedAt      sql.NullString
+	FTags         sql.NullString
+}
+
+type PostListFilter struct {
+	// Tag limits the list to posts with this tag if set
+	Tag string
+	// SavedOnly limits the list to posts bookmarked by the user
+	SavedOnly      bool
+	OrderBySavedAt bool
+	// OrderByNewest ignores the rank, e.g. for the feed of new posts
+	OrderByNewest bool
+	// Type limits the list to one post type if set
+	Type PostType
+	// PinnedFirst puts pinned posts and announcements above everything else,
+	// off for lists that are not shown on the site like the digest
+	PinnedFirst bool
 }
 
 type PostForRanking struct {
@@ -252,22 +482,163 @@ func (ph *PostHandler) UpdateRank(postID int64, rank int) error {
 		postID,
 	)
 	if err != nil {
-		log.Error.Printf("Error updating post rank: %v", err)
+		slog.Error("error updating post rank", "err", err)
 		return err
 	}
 	return nil
 }
 
+// deletePost also removes the notifications about the post,
+// their links would lead nowhere
 func (ph *PostHandler) deletePost(postID int, userID string) error {
-	// Delete a post from the database
-	_, err := ph.db.Exec(
+	tx, err := ph.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		`DELETE FROM posts WHERE id = ? AND fk_user_id = ?`,
 		postID,
 		userID,
 	)
 	if err != nil {
-		log.Error.Printf("Error deleting post: %v", err)
+		slog.Error("error deleting post", "err", err)
+		return err
+	}
+	// other users' posts are not found either
+	if err := expectOneRow(result); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE fk_post_id = ?`, postID); err != nil {
+		slog.Error("error deleting notifications of post", "postID", postID, "err", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ph *PostHandler) setPinned(postID int, pinned bool) error {
+	result, err := ph.db.Exec(`UPDATE posts SET pinned = ? WHERE id = ?`, pinned, postID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+func (ph *PostHandler) setLocked(postID int, locked bool) error {
+	result, err := ph.db.Exec(`UPDATE posts SET locked = ? WHERE id = ?`, locked, postID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result)
+}
+
+// PostIsLocked is false for posts that do not exist,
+// the caller fails on those anyway
+func (ph *PostHandler) PostIsLocked(postID int) (bool, error) {
+	var locked bool
+	err := ph.db.QueryRow(`SELECT locked FROM posts WHERE id = ?`, postID).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return locked, err
+}
+
+func expectOneRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// migrateURLNotUnique rebuilds the posts table of databases created before
+// reposting was possible, because SQLite cannot drop a UNIQUE constraint.
+func (ph *PostHandler) migrateURLNotUnique() error {
+	var tableSQL string
+	err := ph.db.QueryRow(
+		`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'posts'`,
+	).Scan(&tableSQL)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(tableSQL, "url TEXT UNIQUE") {
+		return nil
+	}
+
+	tx, err := ph.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	newTableSQL := strings.Replace(tableSQL, "url TEXT UNIQUE", "url TEXT", 1)
+	newTableSQL = strings.Replace(newTableSQL, "posts", "posts_migrated", 1)
+
+	statements := []string{
+		newTableSQL,
+		`INSERT INTO posts_migrated SELECT * FROM posts`,
+		`DROP TABLE posts`,
+		`ALTER TABLE posts_migrated RENAME TO posts`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_url ON posts(url)`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("migrated posts table")
+	return tx.Commit()
+}
+
+// migrateCanonicalURL adds the column duplicate detection looks up and
+// fills it for posts submitted before it existed. Stored urls went through
+// the sanitizer, so they are unescaped before canonicalizing to match what
+// canonical.URL makes of a submitted url.
+func (ph *PostHandler) migrateCanonicalURL() error {
+	if err := ph.db.AddColumnIfMissing("posts", "url_canonical", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := ph.db.Exec(`CREATE INDEX IF NOT EXISTS idx_posts_url_canonical ON posts(url_canonical)`); err != nil {
+		return err
+	}
+
+	rows, err := ph.db.Query(`SELECT id, url FROM posts WHERE url IS NOT NULL AND url != '' AND url_canonical IS NULL`)
+	if err != nil {
 		return err
 	}
+
+	canonicalURLs := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			rows.Close()
+			return err
+		}
+
+		canonicalURL, err := canonical.URL(html.UnescapeString(url))
+		if err != nil {
+			continue
+		}
+		canonicalURLs[id] = canonicalURL
+	}
+	rows.Close()
+
+	for id, canonicalURL := range canonicalURLs {
+		if _, err := ph.db.Exec(`UPDATE posts SET url_canonical = ? WHERE id = ?`, canonicalURL, id); err != nil {
+			return err
+		}
+	}
+
+	if len(canonicalURLs) > 0 {
+		slog.Info("added canonical urls to posts", "count", len(canonicalURLs))
+	}
 	return nil
 }
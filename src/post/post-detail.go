@@ -1,12 +1,15 @@
 package post
 
 import (
-	"agora/src/log"
+	"agora/src/audit"
 	"agora/src/post/comment"
+	"agora/src/post/poll"
 	"agora/src/render"
 	"agora/src/server/auth"
+	"agora/src/validation"
 	"agora/src/x/date"
 	"agora/src/x/sanitize"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -15,8 +18,6 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// TODO: try this out: https://go.dev/blog/slog
-
 //go:embed post-detail.html
 var postDetailTemplate string
 
@@ -26,35 +27,44 @@ var commentFormTemplate string
 //go:embed comment/comment-list.html
 var commentListTemplate string
 
+//go:embed poll/poll.html
+var pollTemplate string
+
 func (ph *PostHandler) PostDetailGETHandler(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	postIDasString := vars["id"]
 	postID, err := strconv.Atoi(postIDasString)
 	if err != nil {
-		log.Error.Printf("msg='could not convert postID from string to int' postID='%s' err='%s'\n", postIDasString, err.Error())
+		slog.ErrorContext(r.Context(), "could not convert postID from string to int", "postID", postIDasString, "err", err)
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
 		return
 	}
 
+	ph.renderDetail(w, r, postID, CommentForm{})
+}
+
+// renderDetail renders the post with its comments,
+// the comment form is prefilled so a rejected comment can be corrected
+func (ph *PostHandler) renderDetail(w http.ResponseWriter, r *http.Request, postID int, commentForm CommentForm) {
 	// TODO: probably should differentiate between problems
 	// so we can send 404 if post not found
 	record, err := ph.QueryOnePost(postID)
 	if err != nil {
-		log.Error.Printf("msg='could not query post by ID' postID='%d' err='%s'\n", postID, err.Error())
+		slog.ErrorContext(r.Context(), "could not query post by ID", "postID", postID, "err", err)
 		http.Error(w, "Could not retrieve post", http.StatusInternalServerError)
 		return
 	}
 
 	if record == (PostDetailRecord{}) {
-		log.Error.Printf("msg='post not found' postID='%d'\n", postID)
+		slog.ErrorContext(r.Context(), "post not found", "postID", postID)
 		http.Error(w, "Post not found", http.StatusNotFound)
 		return
 	}
 
 	records, err := ph.ch.QueryAllCommentyByPostID(int(record.ID))
 	if err != nil {
-		log.Error.Printf("msg='could not query comments for post' postID='%d' err='%s'\n", record.ID, err.Error())
+		slog.ErrorContext(r.Context(), "could not query comments for post", "postID", record.ID, "err", err)
 		http.Error(w, "Could not retrieve comments", http.StatusInternalServerError)
 		return
 	}
@@ -67,27 +77,61 @@ func (ph *PostHandler) PostDetailGETHandler(w http.ResponseWriter, r *http.Reque
 			UserID:    commentRecord.UserID,
 			CreatedAt: date.FormatDate(commentRecord.CreatedAt),
 			UserName:  commentRecord.UserName,
+
+			ParentID:       int(commentRecord.ParentID.Int64),
+			ParentUserName: commentRecord.ParentUserName.String,
 		})
 	}
 
+	user, _ := auth.ExtractUserFromContext(r.Context())
+	userSaved, err := ph.queryUserSaved(postID, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query bookmark of post", "postID", postID, "err", err)
+	}
+
+	postPoll, hasPoll, err := ph.plh.QueryPoll(postID, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query poll of post", "postID", postID, "err", err)
+	}
+	// a locked post takes no votes, so its poll is shown like a closed one
+	if record.Locked {
+		postPoll.Closed = true
+	}
+
 	postView := PostDetailItem{
 		ID:               int(record.ID),
 		Title:            record.Title,
 		URL:              record.URL.String,
 		Description:      record.Description,
 		CreatedAt:        date.FormatDate(record.CreatedAt),
+		Type:             record.Type,
+		UserID:           record.FUserID,
 		UserName:         record.FUserName,
 		NumberOFComments: record.FNrOfComments,
+		Tags:             splitTags(record.FTags),
+		UserSaved:        userSaved,
+		Pinned:           record.Pinned,
+		Locked:           record.Locked,
+	}
+	if record.ExpiresAt.Valid {
+		postView.ExpiresAt = date.FormatDate(record.ExpiresAt.String)
 	}
 
 	pageData := &render.Page{
 		Title: "Post: " + record.Title,
 		Data: struct {
-			Post     PostDetailItem
-			Comments []CommentListItem
+			Post        PostDetailItem
+			Comments    []CommentListItem
+			CommentForm CommentForm
+			Duplicate   bool
+			// Poll is nil for posts without a poll
+			Poll *poll.Poll
 		}{
-			Post:     postView,
-			Comments: commentListItems,
+			Post:        postView,
+			Comments:    commentListItems,
+			CommentForm: commentForm,
+			Duplicate:   r.URL.Query().Get("duplicate") != "",
+			Poll:        pollOrNil(postPoll, hasPoll),
 		},
 	}
 
@@ -99,9 +143,17 @@ func (ph *PostHandler) PostDetailGETHandler(w http.ResponseWriter, r *http.Reque
 		postDetailTemplate,
 		commentFormTemplate,
 		commentListTemplate,
+		pollTemplate,
 	)
 }
 
+func pollOrNil(p poll.Poll, found bool) *poll.Poll {
+	if !found {
+		return nil
+	}
+	return &p
+}
+
 func (ph *PostHandler) PostDetailDELETEHandler(w http.ResponseWriter, r *http.Request) {
 	user, ok := auth.ExtractUserFromContext(r.Context())
 	if !ok {
@@ -114,26 +166,43 @@ func (ph *PostHandler) PostDetailDELETEHandler(w http.ResponseWriter, r *http.Re
 
 	postID, err := strconv.Atoi(varPostID)
 	if err != nil {
-		log.Error.Printf(
-			"msg='could not convert postid from string to int' postID='%s'\n",
-			varPostID)
+		slog.ErrorContext(r.Context(), "could not convert postid from string to int", "postID", varPostID)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := ph.deletePost(postID, user.ID); err != nil {
-		log.Error.Printf("msg='could not delete post' postID='%d' userID='%s' err='%s'\n", postID, user.ID, err.Error())
+	// the title is kept in the audit log, the post is gone afterwards
+	record, err := ph.QueryOnePost(postID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query post to delete", "postID", postID, "err", err)
+		http.Error(w, "Could not delete post", http.StatusInternalServerError)
+		return
+	}
+
+	err = ph.deletePost(postID, user.ID)
+	if err == ErrPostNotFound {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not delete post", "postID", postID, "userID", user.ID, "err", err)
 		http.Error(w, "Could not delete post", http.StatusInternalServerError)
 		return
 	}
 
 	ph.ch.RemoveAllCommentsOfPost(postID)
+	ph.th.RemoveAllTagsOfPost(postID)
+	ph.bh.RemoveAllBookmarksOfPost(postID)
+	ph.plh.RemovePollOfPost(postID)
 	// TODO: should remove votes,
 	// but the vote handler already uses post handler
 	// so we cannot create a circular dependency
 	// Move interaction to a channel and messages?
 	// ph.vh.RemoveAllVotesOfPost(postID)
 
+	ph.ah.Record(r, user.ID, audit.PostDeleted, audit.PostTarget(postID), record.Title)
+	slog.InfoContext(r.Context(), "deleted post", "postID", postID, "userID", user.ID)
+
 	http.Redirect(w, r, "/posts/", http.StatusSeeOther)
 }
 
@@ -143,8 +212,23 @@ type PostDetailItem struct {
 	URL              string
 	Description      string
 	CreatedAt        string
+	Type             PostType
+	UserID           string
 	UserName         string
 	NumberOFComments int
+	Tags             []string
+	UserSaved        bool
+	Pinned           bool
+	Locked           bool
+
+	// ExpiresAt is empty for posts that do not expire
+	ExpiresAt string
+}
+
+type CommentForm struct {
+	Text     string
+	ParentID int64
+	Errors   validation.Errors
 }
 
 type CommentListItem struct {
@@ -153,6 +237,9 @@ type CommentListItem struct {
 	UserID    string
 	CreatedAt string
 	UserName  string
+
+	ParentID       int
+	ParentUserName string
 }
 
 func (ph *PostHandler) PostCommentPOSTHandler(w http.ResponseWriter, r *http.Request) {
@@ -167,28 +254,67 @@ func (ph *PostHandler) PostCommentPOSTHandler(w http.ResponseWriter, r *http.Req
 
 	postID, err := strconv.Atoi(varPostID)
 	if err != nil {
-		log.Error.Printf(
-			"msg='could not convert postid from string to int' postID='%s'\n",
-			varPostID)
+		slog.ErrorContext(r.Context(), "could not convert postid from string to int", "postID", varPostID)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	locked, err := ph.PostIsLocked(postID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not check if post is locked", "postID", postID, "err", err)
+		http.Error(w, "Could not add comment", http.StatusInternalServerError)
+		return
+	}
+	if locked {
+		http.Error(w, "This post is locked by a moderator, new comments are not allowed", http.StatusForbidden)
+		return
+	}
+
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Invalid form data", http.StatusBadRequest)
 		return
 	}
 
-	newComment := comment.CommentInsertRecord{
+	form := CommentForm{
 		Text:   sanitize.Sanitize(r.FormValue("comment")),
-		PostID: postID,
-		UserID: user.ID,
+		Errors: validation.Errors{},
+	}
+
+	if parentID := r.FormValue("parent_id"); parentID != "" {
+		form.ParentID, err = strconv.ParseInt(parentID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+
+		belongs, err := ph.ch.CommentBelongsToPost(form.ParentID, postID)
+		if err != nil || !belongs {
+			slog.ErrorContext(r.Context(), "reply to unknown comment", "postID", postID, "parentID", form.ParentID)
+			http.Error(w, "The comment you replied to does not exist", http.StatusBadRequest)
+			return
+		}
+	}
+
+	form.Errors.Comment("comment", form.Text)
+	if !form.Errors.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ph.renderDetail(w, r, postID, form)
+		return
+	}
+
+	newComment := comment.CommentInsertRecord{
+		Text:     form.Text,
+		PostID:   postID,
+		UserID:   user.ID,
+		ParentID: form.ParentID,
 	}
 
 	newCommentID, err := ph.ch.InsertNewComment(newComment)
 	if err != nil {
-		log.Error.Printf("msg='could not add new comment' postID='%d' err='%s'\n", postID, err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "could not add new comment", "postID", postID, "err", err)
+		form.Errors.Check(false, "comment", "Could not save the comment, please try again")
+		w.WriteHeader(http.StatusInternalServerError)
+		ph.renderDetail(w, r, postID, form)
 		return
 	}
 
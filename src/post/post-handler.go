@@ -1,18 +1,47 @@
 package post
 
 import (
+	"agora/src/audit"
 	"agora/src/db"
+	"agora/src/event"
+	"agora/src/post/bookmark"
 	"agora/src/post/comment"
+	"agora/src/post/poll"
+	"agora/src/post/tag"
 )
 
 type PostHandler struct {
-	db *db.DB
-	ch *comment.CommentHandler
+	db  *db.DB
+	ch  *comment.CommentHandler
+	th  *tag.TagHandler
+	bh  *bookmark.BookmarkHandler
+	plh *poll.PollHandler
+	ah  *audit.AuditHandler
+
+	bus *event.Bus
+	// repostAfterDays allows submitting an already posted url again
+	// once the existing post is older than that. 0 disables reposting.
+	repostAfterDays int
 }
 
-func NewPostHandler(db *db.DB, ch *comment.CommentHandler) *PostHandler {
+func NewPostHandler(
+	db *db.DB,
+	ch *comment.CommentHandler,
+	th *tag.TagHandler,
+	bh *bookmark.BookmarkHandler,
+	plh *poll.PollHandler,
+	ah *audit.AuditHandler,
+	bus *event.Bus,
+	repostAfterDays int,
+) *PostHandler {
 	return &PostHandler{
-		db: db,
-		ch: ch,
+		db:              db,
+		ch:              ch,
+		th:              th,
+		bh:              bh,
+		plh:             plh,
+		ah:              ah,
+		bus:             bus,
+		repostAfterDays: repostAfterDays,
 	}
 }
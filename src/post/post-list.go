@@ -1,35 +1,119 @@
 package post
 
 import (
-	"agora/src/log"
+	"agora/src/post/bookmark"
+	"agora/src/post/tag"
 	"agora/src/render"
 	"agora/src/server/auth"
 	"agora/src/x/date"
+	"database/sql"
 	_ "embed"
+	"log/slog"
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"golang.org/x/net/context"
+	"github.com/gorilla/mux"
 )
 
 func (ph *PostHandler) PostListHandler(w http.ResponseWriter, r *http.Request) {
+	ph.listPosts(w, r, postListOptions{
+		Heading:  "Posts",
+		BasePath: "/posts",
+		Filter:   PostListFilter{PinnedFirst: true},
+	})
+}
+
+func (ph *PostHandler) AskPostsHandler(w http.ResponseWriter, r *http.Request) {
+	ph.listPosts(w, r, postListOptions{
+		Heading:  "Ask",
+		BasePath: "/ask",
+		Filter:   PostListFilter{Type: TypeAsk},
+	})
+}
+
+func (ph *PostHandler) ShowPostsHandler(w http.ResponseWriter, r *http.Request) {
+	ph.listPosts(w, r, postListOptions{
+		Heading:  "Show",
+		BasePath: "/show",
+		Filter:   PostListFilter{Type: TypeShow},
+	})
+}
+
+// SavedPostsHandler lists the posts bookmarked by the user,
+// most recently saved first unless sorted by rank
+func (ph *PostHandler) SavedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	sortByRank := r.URL.Query().Get("sort") == "rank"
+	pageQuery := ""
+	if sortByRank {
+		pageQuery = "sort=rank&"
+	}
+
+	ph.listPosts(w, r, postListOptions{
+		Heading:   "Saved Posts",
+		BasePath:  "/saved",
+		PageQuery: pageQuery,
+		Filter: PostListFilter{
+			SavedOnly:      true,
+			OrderBySavedAt: !sortByRank,
+		},
+	})
+}
+
+// TagFeedHandler lists the posts of a single tag in the same order as the front page.
+// Only the normalized name ends up in the page, the raw path is never echoed.
+func (ph *PostHandler) TagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	tagName := tag.Normalize(mux.Vars(r)["tag"])
+	if tagName == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	exists, err := ph.th.TagExists(tagName)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not check if tag exists", "tag", tagName, "err", err)
+		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	ph.listPosts(w, r, postListOptions{
+		Heading:  "#" + tagName,
+		BasePath: "/tags/" + tagName,
+		Filter:   PostListFilter{Tag: tagName, PinnedFirst: true},
+	})
+}
+
+type postListOptions struct {
+	Heading string
+	// BasePath is where the pagination links point to
+	BasePath string
+	// PageQuery is kept in the pagination links, e.g. "sort=rank&"
+	PageQuery string
+	Filter    PostListFilter
+}
+
+func (ph *PostHandler) listPosts(w http.ResponseWriter, r *http.Request, options postListOptions) {
 	context := r.Context()
 	user, ok := auth.ExtractUserFromContext(context)
 	if !ok {
-		log.Error.Printf("msg='could not get user from context' context='%#v'\n", context)
+		slog.ErrorContext(r.Context(), "could not get user from context")
 		http.Error(w, "User not logged in", http.StatusUnauthorized)
 		return
 	}
 
-	records, err := ph.QueryAllPostsForTheList(user.ID)
+	records, err := ph.QueryAllPostsForTheList(user.ID, options.Filter)
 	if err != nil {
-		log.Error.Printf("msg='could not query all posts' err='%s'\n", err.Error())
+		slog.ErrorContext(r.Context(), "could not query all posts", "err", err)
 		http.Error(w, "Could not retrieve posts", http.StatusInternalServerError)
 	}
 
 	if len(records) == 0 {
-		ph.renderList(w, nil, 1, 1, r.Context())
+		ph.renderList(w, r, nil, 1, 1, options)
 		return
 	}
 
@@ -42,17 +126,17 @@ func (ph *PostHandler) PostListHandler(w http.ResponseWriter, r *http.Request) {
 		var err error
 		page, err = strconv.Atoi(qPage)
 		if err != nil {
-			log.Error.Printf("msg='could not convert page from string to int' page='%s'\n", qPage)
+			slog.ErrorContext(r.Context(), "could not convert page from string to int", "page", qPage)
 			http.Error(w, "Invalid page number", http.StatusBadRequest)
 			return
 		}
 		if page < 1 {
-			log.Error.Printf("msg='page number is less than 1' page='%d'\n", page)
+			slog.ErrorContext(r.Context(), "page number is less than 1", "page", page)
 			http.Error(w, "Page number must be greater than 0", http.StatusBadRequest)
 			return
 		}
 		if page > totalPages {
-			log.Error.Printf("msg='page number is greater than total pages' page='%d' totalPages='%d'\n", page, totalPages)
+			slog.ErrorContext(r.Context(), "page number is greater than total pages", "page", page, "totalPages", totalPages)
 			http.Error(w, "Page number exceeds total pages", http.StatusBadRequest)
 			return
 		}
@@ -72,27 +156,39 @@ func (ph *PostHandler) PostListHandler(w http.ResponseWriter, r *http.Request) {
 		if len(CutOfDescription) > descCutLength {
 			CutOfDescription = CutOfDescription[:descCutLength] + " …"
 		}
-		postListItems = append(postListItems, PostListItem{
+		item := PostListItem{
 			ID:               int(record.ID),
 			Title:            record.Title,
 			URL:              record.URL.String,
 			Description:      CutOfDescription,
 			CreatedAt:        date.FormatDate(record.CreatedAt),
+			Type:             record.Type,
+			Pinned:           record.Pinned,
+			Locked:           record.Locked,
+			UserID:           record.FUserID,
 			UserName:         record.FUserName,
 			NumberOfComments: record.FNrOfComments,
 			NumberOfVotes:    record.FNrOfVotes,
+			Tags:             splitTags(record.FTags),
 			UserVoted:        record.UserVoted == 1,
+			UserSaved:        record.UserSaved == 1,
+			BookmarkNote:     record.FBookmarkNote.String,
 			// Disabled this flag to turn off delete functionality
 			// For that to really work we need to setup a message queue (MQ)
 			// between the modules so modules can react to deletions
 			// with out a MQ we would have a circular dependency
 			// UserIsAuthor:     record.UserIsAuthor == 1,
 			UserIsAuthor: false,
-		})
+		}
+		// only bookmarked posts have a save date
+		if record.FSavedAt.Valid {
+			item.SavedAt = date.FormatDate(record.FSavedAt.String)
+		}
+		postListItems = append(postListItems, item)
 
 	}
 
-	ph.renderList(w, postListItems, page, totalPages, r.Context())
+	ph.renderList(w, r, postListItems, page, totalPages, options)
 }
 
 //go:embed post-list.html
@@ -100,24 +196,39 @@ var postListTemplate string
 
 func (ph *PostHandler) renderList(
 	w http.ResponseWriter,
+	r *http.Request,
 	postListItems []PostListItem,
 	page int,
 	totalPages int,
-	ctx context.Context,
+	options postListOptions,
 ) {
 
 	render.RenderTemplate(
 		w,
 		"post-list.html",
 		&render.Page{
-			Title: "Posts",
+			Title: options.Heading,
 			Data: struct {
+				Heading     string
+				BasePath    string
+				PageQuery   string
+				CurrentPath string
+				Saved       bool
+				SortByRank  bool
+				Error       string
 				Posts       []PostListItem
 				HasPrevPage bool
 				HasNextPage bool
 				PrevPage    int
 				NextPage    int
 			}{
+				Heading:     options.Heading,
+				BasePath:    options.BasePath,
+				PageQuery:   options.PageQuery,
+				CurrentPath: r.URL.RequestURI(),
+				Saved:       options.Filter.SavedOnly,
+				SortByRank:  options.Filter.SavedOnly && !options.Filter.OrderBySavedAt,
+				Error:       bookmark.ErrorMessage(r.URL.Query().Get("error")),
 				Posts:       postListItems,
 				HasPrevPage: page > 1,
 				HasNextPage: page < totalPages,
@@ -125,7 +236,7 @@ func (ph *PostHandler) renderList(
 				NextPage:    page + 1,
 			},
 		},
-		ctx,
+		r.Context(),
 		postListTemplate,
 	)
 }
@@ -136,9 +247,24 @@ type PostListItem struct {
 	URL              string
 	Description      string
 	CreatedAt        string
+	Type             PostType
+	Pinned           bool
+	Locked           bool
+	UserID           string
 	UserName         string
 	NumberOfComments int
 	NumberOfVotes    int
+	Tags             []string
 	UserVoted        bool
+	UserSaved        bool
+	BookmarkNote     string
+	SavedAt          string
 	UserIsAuthor     bool
 }
+
+func splitTags(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return nil
+	}
+	return strings.Split(tags.String, ",")
+}
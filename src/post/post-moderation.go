@@ -0,0 +1,72 @@
+package post
+
+import (
+	"agora/src/audit"
+	"agora/src/server/auth"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// PostPinPOSTHandler pins or unpins a post,
+// pinned posts are listed above the ranked ones
+func (ph *PostHandler) PostPinPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	ph.moderate(w, r, "pinned", ph.setPinned, audit.PostPinned, audit.PostUnpinned)
+}
+
+// PostLockPOSTHandler locks or unlocks a post,
+// locked posts take no new comments or votes
+func (ph *PostHandler) PostLockPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	ph.moderate(w, r, "locked", ph.setLocked, audit.PostLocked, audit.PostUnlocked)
+}
+
+// moderate switches the flag of a post on or off, depending on the form value
+// of field, and records who did it in the audit log
+func (ph *PostHandler) moderate(
+	w http.ResponseWriter,
+	r *http.Request,
+	field string,
+	set func(postID int, on bool) error,
+	actionOn audit.Action,
+	actionOff audit.Action,
+) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsModerator() {
+		http.Error(w, "Only moderators can do this", http.StatusForbidden)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	on := r.FormValue(field) == "true"
+
+	err = set(postID, on)
+	if err == ErrPostNotFound {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not moderate post", "postID", postID, "field", field, "on", on, "err", err)
+		http.Error(w, "Could not update post", http.StatusInternalServerError)
+		return
+	}
+
+	action := actionOff
+	if on {
+		action = actionOn
+	}
+	ph.ah.Record(r, user.ID, action, audit.PostTarget(postID), "")
+	slog.InfoContext(r.Context(), "moderated post", "postID", postID, "action", action, "userID", user.ID)
+
+	http.Redirect(w, r, "/posts/"+strconv.Itoa(postID), http.StatusSeeOther)
+}
@@ -1,8 +1,8 @@
 package post
 
 import (
-	"agora/src/log"
 	"fmt"
+	"log/slog"
 	"math"
 	"time"
 )
@@ -11,7 +11,7 @@ import (
 func (ph *PostHandler) GenerateNewRanks() {
 	posts, err := ph.QueryAllPostsForRanking()
 	if err != nil {
-		log.Error.Printf("Could not retrieve posts: %v", err)
+		slog.Error("could not retrieve posts", "err", err)
 		return
 	}
 
@@ -19,7 +19,7 @@ func (ph *PostHandler) GenerateNewRanks() {
 		score := ph.calculatePostRank(post.FNrOfVotes, post.CreatedAt)
 		err = ph.UpdateRank(post.ID, score)
 		if err != nil {
-			log.Error.Printf("Could not update rank for post %d: %v", post.ID, err)
+			slog.Error("could not update rank of post", "postID", post.ID, "err", err)
 		}
 	}
 }
@@ -49,7 +49,7 @@ func (ph *PostHandler) calculatePostRank(votes int, creationDate string) int {
 	// Calculate the age of the post in hours
 	creationTime, err := time.Parse(time.RFC3339, creationDate)
 	if err != nil {
-		log.Error.Printf("Could not parse creation date: %v", err)
+		slog.Error("could not parse creation date", "err", err)
 		return 0
 	}
 	ageInHours := int(time.Since(creationTime).Hours())
@@ -1,37 +1,34 @@
 package post
 
 import (
-	"agora/src/log"
+	"agora/src/post/poll"
+	"agora/src/post/tag"
 	"agora/src/render"
 	"agora/src/server/auth"
+	"agora/src/validation"
+	"agora/src/x/canonical"
+	"agora/src/x/date"
 	"agora/src/x/sanitize"
 	_ "embed"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 )
 
 //go:embed post-submit.html
 var postSubmitTemplate string
 
 func (ph *PostHandler) PostSubmitGETHandler(w http.ResponseWriter, r *http.Request) {
-
-	render.RenderTemplate(
-		w,
-		"post-submit.html",
-		&render.Page{
-			Title: "Submit Post",
-			Data:  nil,
-		},
-		r.Context(),
-		postSubmitTemplate,
-	)
+	ph.renderSubmitForm(w, r, PostSubmitForm{Type: TypeLink})
 }
 
 func (ph *PostHandler) PostSubmitPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	context := r.Context()
 	user, ok := auth.ExtractUserFromContext(context)
 	if !ok {
-		log.Error.Printf("msg='could not get user from context' context='%#v'\n", context)
+		slog.ErrorContext(r.Context(), "could not get user from context")
 		http.Error(w, "User not logged in", http.StatusUnauthorized)
 		return
 	}
@@ -41,23 +38,197 @@ func (ph *PostHandler) PostSubmitPOSTHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	title := sanitize.Sanitize(r.FormValue("title"))
-	url := sanitize.Sanitize(r.FormValue("url"))
-	desc := sanitize.Sanitize(r.FormValue("description"))
+	form := PostSubmitForm{
+		Title:              sanitize.Sanitize(r.FormValue("title")),
+		URL:                sanitize.Sanitize(r.FormValue("url")),
+		Description:        sanitize.Sanitize(r.FormValue("description")),
+		Type:               PostType(r.FormValue("type")),
+		ExpiresAt:          r.FormValue("expires_at"),
+		NewTags:            sanitize.Sanitize(r.FormValue("new_tags")),
+		SelectedTags:       tag.ParseList(r.Form["tags"]...),
+		IsPoll:             r.FormValue("poll") == "on",
+		PollOptions:        sanitize.Sanitize(r.FormValue("poll_options")),
+		PollMultipleChoice: r.FormValue("poll_multiple_choice") == "on",
+		PollClosesAt:       r.FormValue("poll_closes_at"),
+		Errors:             validation.Errors{},
+	}
+	tags := tag.ParseList(append(form.SelectedTags, form.NewTags)...)
+
+	form.Errors.Title("title", form.Title)
+	form.Errors.URL("url", form.URL)
+	form.Errors.Description("description", form.Description)
+	form.Errors.Tags("tags", tags)
+
+	expiresAt := ph.parseType(&form, user.IsAdmin())
+
+	var newPoll *poll.NewPoll
+	if form.IsPoll {
+		parsed := ph.parsePoll(form)
+		newPoll = &parsed
+	}
+
+	// canonicalize what was submitted, the sanitizer escapes & in queries
+	canonicalURL, err := canonical.URL(r.FormValue("url"))
+	form.Errors.Check(err == nil, "url", "URL must be a valid http or https link")
+
+	if !form.Errors.Valid() {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		ph.renderSubmitForm(w, r, form)
+		return
+	}
+
+	if canonicalURL != "" {
+		existing, err := ph.QueryPostByURL(canonicalURL)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not check for duplicate url", "url", canonicalURL, "err", err)
+			http.Error(w, "Could not create post", http.StatusInternalServerError)
+			return
+		}
+
+		if existing.ID != 0 && !ph.repostAllowed(existing.CreatedAt) {
+			slog.InfoContext(r.Context(), "duplicate submission", "url", canonicalURL, "postID", existing.ID)
+			http.Redirect(w, r, "/posts/"+strconv.Itoa(int(existing.ID))+"?duplicate=1", http.StatusSeeOther)
+			return
+		}
+	}
 
 	newPost := PostNewRecord{
-		Title:       title,
-		URL:         url,
-		Description: desc,
-		UserID:      user.ID,
+		Title:        form.Title,
+		URL:          form.URL,
+		CanonicalURL: canonicalURL,
+		Description:  form.Description,
+		UserID:       user.ID,
+		Type:         form.Type,
+		ExpiresAt:    expiresAt,
+		Tags:         tags,
+		Poll:         newPoll,
 	}
 
 	newPostID, err := ph.InsertNewPost(newPost)
 	if err != nil {
-		log.Error.Printf("msg='could not create new post' err='%s'\n", err.Error())
-		http.Error(w, "Could not insert create post: "+err.Error(), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "could not create new post", "err", err)
+		form.Errors.Check(false, "form", "Could not create the post, please try again")
+		w.WriteHeader(http.StatusInternalServerError)
+		ph.renderSubmitForm(w, r, form)
 		return
 	}
 
 	http.Redirect(w, r, "/posts/"+strconv.Itoa(int(newPostID)), http.StatusSeeOther)
 }
+
+type PostSubmitForm struct {
+	Title        string
+	URL          string
+	Description  string
+	NewTags      string
+	SelectedTags []string
+
+	Type PostType
+	// ExpiresAt is the value of a datetime-local input,
+	// only used for announcements
+	ExpiresAt string
+
+	IsPoll bool
+	// PollOptions has one option per line
+	PollOptions        string
+	PollMultipleChoice bool
+	// PollClosesAt is the value of a datetime-local input
+	PollClosesAt string
+
+	Errors validation.Errors
+}
+
+// parseType validates the post type of the form and records errors in it,
+// an empty type is a link post. A link post without url is a text post,
+// which is an Ask post, same as migratePostTypes does for old posts.
+// Returns when an announcement expires.
+func (ph *PostHandler) parseType(form *PostSubmitForm, isAdmin bool) time.Time {
+	if form.Type == "" {
+		form.Type = TypeLink
+	}
+	if form.Type == TypeLink && form.URL == "" {
+		form.Type = TypeAsk
+	}
+	form.Errors.Check(form.Type.Valid(), "type", "Post type is not valid")
+	form.Errors.Check(!form.Type.AdminOnly() || isAdmin, "type", "Only admins can post announcements")
+
+	if form.Type != TypeAnnouncement || form.ExpiresAt == "" {
+		return time.Time{}
+	}
+
+	expiresAt, err := time.ParseInLocation(date.DatetimeLocal, form.ExpiresAt, time.Local)
+	form.Errors.Check(err == nil, "expires_at", "Expiry date is not valid")
+	form.Errors.Check(err != nil || expiresAt.After(time.Now()), "expires_at", "Expiry date must be in the future")
+	return expiresAt
+}
+
+// parsePoll validates the poll fields of the form and records errors in it
+func (ph *PostHandler) parsePoll(form PostSubmitForm) poll.NewPoll {
+	newPoll := poll.NewPoll{
+		Options:        poll.ParseOptions(form.PollOptions),
+		MultipleChoice: form.PollMultipleChoice,
+	}
+	form.Errors.PollOptions("poll_options", newPoll.Options)
+
+	if form.PollClosesAt != "" {
+		closesAt, err := time.ParseInLocation(date.DatetimeLocal, form.PollClosesAt, time.Local)
+		form.Errors.Check(err == nil, "poll_closes_at", "Close date is not valid")
+		form.Errors.Check(err != nil || closesAt.After(time.Now()), "poll_closes_at", "Close date must be in the future")
+		newPoll.ClosesAt = closesAt
+	}
+
+	return newPoll
+}
+
+type TagOption struct {
+	Name     string
+	Selected bool
+}
+
+func (ph *PostHandler) renderSubmitForm(w http.ResponseWriter, r *http.Request, form PostSubmitForm) {
+	existingTags, err := ph.th.QueryAllTagsWithCounts()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query tags for the tag picker", "err", err)
+	}
+
+	var tagOptions []TagOption
+	for _, existingTag := range existingTags {
+		tagOptions = append(tagOptions, TagOption{
+			Name:     existingTag.Name,
+			Selected: slices.Contains(form.SelectedTags, existingTag.Name),
+		})
+	}
+
+	render.RenderTemplate(
+		w,
+		"post-submit.html",
+		&render.Page{
+			Title: "Submit Post",
+			Data: struct {
+				PostSubmitForm
+				TagOptions []TagOption
+				PostTypes  []PostType
+			}{
+				PostSubmitForm: form,
+				TagOptions:     tagOptions,
+				PostTypes:      PostTypes,
+			},
+		},
+		r.Context(),
+		postSubmitTemplate,
+	)
+}
+
+func (ph *PostHandler) repostAllowed(existingCreatedAt string) bool {
+	if ph.repostAfterDays <= 0 {
+		return false
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, existingCreatedAt)
+	if err != nil {
+		slog.Error("could not parse creation date", "createdAt", existingCreatedAt, "err", err)
+		return false
+	}
+
+	return time.Since(createdAt) > time.Duration(ph.repostAfterDays)*24*time.Hour
+}
@@ -0,0 +1,39 @@
+package post
+
+type PostType string
+
+const (
+	TypeLink PostType = "link"
+	TypeAsk  PostType = "ask"
+	TypeShow PostType = "show"
+	// TypeAnnouncement can only be posted by admins, announcements
+	// are pinned above all other posts until they expire
+	TypeAnnouncement PostType = "announcement"
+)
+
+// PostTypes in the order they are offered in the submit form
+var PostTypes = []PostType{TypeLink, TypeAsk, TypeShow, TypeAnnouncement}
+
+func (t PostType) Valid() bool {
+	switch t {
+	case TypeLink, TypeAsk, TypeShow, TypeAnnouncement:
+		return true
+	}
+	return false
+}
+
+func (t PostType) AdminOnly() bool {
+	return t == TypeAnnouncement
+}
+
+func (t PostType) Label() string {
+	switch t {
+	case TypeAsk:
+		return "Ask"
+	case TypeShow:
+		return "Show"
+	case TypeAnnouncement:
+		return "Announcement"
+	}
+	return "Link"
+}
@@ -0,0 +1,95 @@
+package post_test
+
+import (
+	"agora/src/audit"
+	"agora/src/db/dbtest"
+	"agora/src/event"
+	"agora/src/post"
+	"agora/src/post/bookmark"
+	"agora/src/post/comment"
+	"agora/src/post/poll"
+	"agora/src/post/tag"
+	"agora/src/user"
+	"agora/src/vote"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTagFeedRouter serves the tag feed with one post tagged go
+func newTagFeedRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	database := dbtest.Open(t)
+	bus := event.NewBus()
+	uh := user.NewUserHandler(database, nil, nil, nil, nil)
+	ah := audit.NewAuditHandler(database)
+	cmh := comment.NewCommentHandler(database, bus)
+	th := tag.NewTagHandler(database, ah)
+	bh := bookmark.NewBookmarkHandler(database)
+	plh := poll.NewPollHandler(database)
+	ph := post.NewPostHandler(database, cmh, th, bh, plh, ah, bus, 0)
+	vh := vote.NewVoteHandler(database, ph, bus)
+	dbtest.Migrate(t,
+		uh.CreateDBTable, ah.CreateDBTable, cmh.CreateDBTable, th.CreateDBTable, bh.CreateDBTable,
+		plh.CreateDBTable, ph.CreateDBTable, vh.CreateDBTable,
+	)
+
+	if _, err := uh.AddUser("u1", "Alice", "alice@example.com"); err != nil {
+		t.Fatalf("could not add user: %v", err)
+	}
+	_, err := ph.InsertNewPost(post.PostNewRecord{
+		Title: "Go and SQLite", Description: "text", UserID: "u1", Type: post.TypeAsk, Tags: []string{"go"},
+	})
+	if err != nil {
+		t.Fatalf("could not insert post: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/tags/{tag}", ph.TagFeedHandler)
+	return router
+}
+
+func getAsAlice(router *mux.Router, path string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	ctx := context.WithValue(request.Context(), "user", user.User{ID: "u1", Name: "Alice", Role: "user"})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request.WithContext(ctx))
+	return recorder
+}
+
+func TestTagFeedShowsTheNormalizedTag(t *testing.T) {
+	router := newTagFeedRouter(t)
+
+	recorder := getAsAlice(router, "/tags/Go")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, "<h1>#go</h1>") || !strings.Contains(body, "Go and SQLite") {
+		t.Errorf("feed should list the post under the normalized tag:\n%s", body)
+	}
+}
+
+func TestTagFeedDoesNotEchoThePath(t *testing.T) {
+	router := newTagFeedRouter(t)
+
+	for _, path := range []string{
+		"/tags/%3Cimg%20src%3Dx%20onerror%3Dalert(1)%3E",
+		"/tags/go%3Cscript%3E",
+		"/tags/%3C%3E",
+		"/tags/unknown",
+	} {
+		recorder := getAsAlice(router, path)
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, recorder.Code)
+		}
+		if body := recorder.Body.String(); strings.Contains(body, "<") {
+			t.Errorf("%s: markup reflected in the response: %s", path, body)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package tag
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS post_tags (
+		fk_post_id INTEGER NOT NULL,
+		fk_tag_id INTEGER NOT NULL,
+
+		UNIQUE(fk_post_id, fk_tag_id),
+		CONSTRAINT "fk_post_id" FOREIGN KEY("fk_post_id") REFERENCES posts(id),
+		CONSTRAINT "fk_tag_id" FOREIGN KEY("fk_tag_id") REFERENCES tags(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(fk_tag_id);
+`
+
+var ErrTagNotFound = errors.New("tag not found")
+var ErrTagExists = errors.New("tag already exists")
+
+func (th *TagHandler) CreateDBTable() error {
+	_, err := th.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating tags tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (th *TagHandler) QueryAllTagsWithCounts() ([]Tag, error) {
+	rows, err := th.db.Query(`
+		SELECT t.id, t.name, count(pt.fk_post_id) nr_posts
+		FROM tags t
+		LEFT JOIN post_tags pt ON pt.fk_tag_id = t.id
+		GROUP BY t.id
+		ORDER BY nr_posts DESC, t.name ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.NumberOfPosts); err != nil {
+			slog.Error("could not scan tag", "err", err)
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// TagExists expects a normalized name
+func (th *TagHandler) TagExists(name string) (bool, error) {
+	var exists bool
+	err := th.db.QueryRow(`SELECT count(*) > 0 FROM tags WHERE name = ?`, name).Scan(&exists)
+	return exists, err
+}
+
+func (th *TagHandler) queryTagIDByName(tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM tags WHERE name = ?`, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrTagNotFound
+	}
+	return id, err
+}
+
+func (th *TagHandler) renameTag(oldName string, newName string) error {
+	tx, err := th.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := th.queryTagIDByName(tx, oldName); err != nil {
+		return err
+	}
+
+	_, err = th.queryTagIDByName(tx, newName)
+	if err == nil {
+		return ErrTagExists
+	}
+	if err != ErrTagNotFound {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE tags SET name = ? WHERE name = ?`, newName, oldName); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// mergeTags moves all posts of source over to target and removes source
+func (th *TagHandler) mergeTags(sourceName string, targetName string) error {
+	tx, err := th.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sourceID, err := th.queryTagIDByName(tx, sourceName)
+	if err != nil {
+		return err
+	}
+
+	targetID, err := th.queryTagIDByName(tx, targetName)
+	if err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{
+			`INSERT OR IGNORE INTO post_tags (fk_post_id, fk_tag_id)
+			 SELECT fk_post_id, ? FROM post_tags WHERE fk_tag_id = ?`,
+			[]any{targetID, sourceID},
+		},
+		{`DELETE FROM post_tags WHERE fk_tag_id = ?`, []any{sourceID}},
+		{`DELETE FROM tags WHERE id = ?`, []any{sourceID}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
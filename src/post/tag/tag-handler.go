@@ -0,0 +1,53 @@
+package tag
+
+import (
+	"agora/src/audit"
+	"agora/src/db"
+	"database/sql"
+)
+
+type TagHandler struct {
+	db *db.DB
+	ah *audit.AuditHandler
+}
+
+func NewTagHandler(db *db.DB, ah *audit.AuditHandler) *TagHandler {
+	return &TagHandler{db: db, ah: ah}
+}
+
+// SetTagsOfPost creates missing tags and links them to the post,
+// in the transaction the post is created in
+func (th *TagHandler) SetTagsOfPost(tx *sql.Tx, postID int64, names []string) error {
+	if _, err := tx.Exec(`DELETE FROM post_tags WHERE fk_post_id = ?`, postID); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, name); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			`INSERT OR IGNORE INTO post_tags (fk_post_id, fk_tag_id)
+			 SELECT ?, id FROM tags WHERE name = ?`,
+			postID,
+			name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (th *TagHandler) RemoveAllTagsOfPost(postID int) error {
+	_, err := th.db.Exec(
+		`DELETE FROM post_tags WHERE fk_post_id = ?`,
+		postID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package tag
+
+import (
+	"agora/src/audit"
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/validation"
+	_ "embed"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed tag-index.html
+var tagIndexTemplate string
+
+func (th *TagHandler) TagIndexGETHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := th.QueryAllTagsWithCounts()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query tags", "err", err)
+		http.Error(w, "Could not retrieve tags", http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(
+		w,
+		"tag-index.html",
+		&render.Page{
+			Title: "Tags",
+			Data: struct {
+				Tags  []Tag
+				Error string
+			}{
+				Tags:  tags,
+				Error: indexErrors[r.URL.Query().Get("error")],
+			},
+		},
+		r.Context(),
+		tagIndexTemplate,
+	)
+}
+
+func (th *TagHandler) TagRenamePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsModerator() {
+		http.Error(w, "Only moderators can rename tags", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	oldName := mux.Vars(r)["tag"]
+	newName := Normalize(r.FormValue("name"))
+	if newName == "" || !validation.MaxLength(newName, validation.TagMaxLength) {
+		redirectToIndexWithError(w, r, errInvalidName)
+		return
+	}
+
+	err := th.renameTag(oldName, newName)
+	if err == ErrTagExists {
+		redirectToIndexWithError(w, r, errNameTaken)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not rename tag", "tag", oldName, "newName", newName, "err", err)
+		http.Error(w, "Could not rename tag", http.StatusInternalServerError)
+		return
+	}
+
+	th.ah.Record(r, user.ID, audit.TagRenamed, audit.TagTarget(oldName), "new name="+newName)
+	slog.InfoContext(r.Context(), "renamed tag", "tag", oldName, "newName", newName, "userID", user.ID)
+	http.Redirect(w, r, "/tags/", http.StatusSeeOther)
+}
+
+func (th *TagHandler) TagMergePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsModerator() {
+		http.Error(w, "Only moderators can merge tags", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	source := mux.Vars(r)["tag"]
+	target := Normalize(r.FormValue("target"))
+	if target == "" || target == source {
+		redirectToIndexWithError(w, r, errSameTag)
+		return
+	}
+
+	err := th.mergeTags(source, target)
+	if err == ErrTagNotFound {
+		redirectToIndexWithError(w, r, errUnknownTarget)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not merge tags", "source", source, "target", target, "err", err)
+		http.Error(w, "Could not merge tags", http.StatusInternalServerError)
+		return
+	}
+
+	th.ah.Record(r, user.ID, audit.TagMerged, audit.TagTarget(source), "merged into="+target)
+	slog.InfoContext(r.Context(), "merged tags", "source", source, "target", target, "userID", user.ID)
+	http.Redirect(w, r, "/tags/", http.StatusSeeOther)
+}
+
+// The index shows errors by code, a message in the URL
+// would end up in the page as it is
+const (
+	errInvalidName   = "invalid-name"
+	errNameTaken     = "name-taken"
+	errSameTag       = "same-tag"
+	errUnknownTarget = "unknown-target"
+)
+
+var indexErrors = map[string]string{
+	errInvalidName:   "The new tag name is not valid",
+	errNameTaken:     "A tag with this name already exists, merge the tags instead",
+	errSameTag:       "Choose a different tag to merge into",
+	errUnknownTarget: "The tag to merge into does not exist",
+}
+
+func redirectToIndexWithError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, "/tags/?error="+code, http.StatusSeeOther)
+}
@@ -0,0 +1,52 @@
+package tag
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Tag struct {
+	ID            int
+	Name          string
+	NumberOfPosts int
+}
+
+// Normalize turns user input like " Machine Learning" into "machine-learning"
+func Normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	var b strings.Builder
+	lastWasDash := false
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			lastWasDash = false
+		case r == '-' || r == '_' || unicode.IsSpace(r):
+			if !lastWasDash && b.Len() > 0 {
+				b.WriteRune('-')
+				lastWasDash = true
+			}
+		}
+	}
+
+	return strings.TrimRight(b.String(), "-")
+}
+
+// ParseList splits a comma separated list of tags,
+// normalizes them and drops empty and duplicate entries
+func ParseList(values ...string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, raw := range strings.Split(value, ",") {
+			name := Normalize(raw)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
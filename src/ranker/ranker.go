@@ -1,45 +1,78 @@
 package ranker
 
 import (
-	"agora/src/log"
+	"agora/src/metrics"
 	"agora/src/post"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Ranker struct {
 	hourTicker *time.Ticker
 	ph         *post.PostHandler // Assuming PostHandler is defined in the same package or imported
+	stop       chan struct{}
+	stopped    sync.WaitGroup
+	running    atomic.Bool
 }
 
+var (
+	runDuration = metrics.NewHistogram(
+		"agora_ranker_run_duration_seconds",
+		"Duration of ranking all posts.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+	)
+	lastRun = metrics.NewGauge(
+		"agora_ranker_last_run_timestamp_seconds",
+		"Unix time the last ranking finished.",
+	)
+)
+
 func NewRanker(ph *post.PostHandler) *Ranker {
 	return &Ranker{
 		// hourTicker: time.NewTicker(time.Second * 10),
 		hourTicker: time.NewTicker(time.Hour),
 		ph:         ph,
+		stop:       make(chan struct{}),
 	}
 }
 
 func (r *Ranker) RankPosts() {
+	start := time.Now()
 	r.ph.GenerateNewRanks()
+	runDuration.Observe(time.Since(start).Seconds())
+	lastRun.Set(float64(time.Now().Unix()))
 }
 
 func (r *Ranker) Start() {
 	r.RankPosts()
 
+	r.running.Store(true)
+	r.stopped.Add(1)
 	go func() {
+		defer r.stopped.Done()
+
 		for {
-			if r.hourTicker == nil {
-				log.Error.Println("Ranker ticker channel is nil, stopping ranker service.")
-				break
+			select {
+			case <-r.hourTicker.C:
+				r.RankPosts()
+			case <-r.stop:
+				return
 			}
-
-			<-r.hourTicker.C
-			r.RankPosts()
 		}
 	}()
 
 }
 
+// Stop waits for a running ranking to finish
 func (r *Ranker) Stop() {
+	r.running.Store(false)
 	r.hourTicker.Stop()
+	close(r.stop)
+	r.stopped.Wait()
+}
+
+// Running reports whether the ranker ranks posts every hour
+func (r *Ranker) Running() bool {
+	return r.running.Load()
 }
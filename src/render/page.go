@@ -1,7 +1,29 @@
 package render
 
+import (
+	"agora/src/user"
+	"context"
+)
+
 type Page struct {
 	Title string
 	Data  interface{}
-	User  struct{ Name string }
+	User  user.User
+	// UnreadNotifications is shown as badge in the header
+	UnreadNotifications int
+	// CSRFToken is sent by every form with {{ template "csrf.html" $ }}
+	CSRFToken string
+}
+
+type unreadNotificationsKey struct{}
+
+// WithUnreadNotifications stores the unread count for the header,
+// it is set by a middleware so every page shows the badge
+func WithUnreadNotifications(ctx context.Context, count int) context.Context {
+	return context.WithValue(ctx, unreadNotificationsKey{}, count)
+}
+
+func unreadNotificationsFromContext(ctx context.Context) int {
+	count, _ := ctx.Value(unreadNotificationsKey{}).(int)
+	return count
 }
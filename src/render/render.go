@@ -1,10 +1,10 @@
 package render
 
 import (
-	"agora/src/log"
 	"agora/src/server/auth"
 	"context"
 	_ "embed"
+	"log/slog"
 	"net/http"
 	"text/template"
 )
@@ -24,7 +24,7 @@ func RenderTemplate(
 ) {
 	user, ok := auth.ExtractUserFromContext(ctx)
 	if !ok {
-		log.Error.Printf("msg='could not get user from context' context='%#v'\n", ctx)
+		slog.ErrorContext(ctx, "could not get user from context")
 		http.Error(w, "User not logged in", http.StatusUnauthorized)
 		return
 	}
@@ -41,11 +41,13 @@ func RenderTemplate(
 		var err error
 		parsedTemplates, err = parsedTemplates.Parse(tmpl)
 		if err != nil {
-			log.Error.Printf("msg='could not parse template' template='%s' err='%s'\n", tmpl, err.Error())
+			slog.ErrorContext(ctx, "could not parse template", "template", tmpl, "err", err)
 		}
 	}
 
-	page.User.Name = user.Name
+	page.User = user
+	page.UnreadNotifications = unreadNotificationsFromContext(ctx)
+	page.CSRFToken = auth.CSRFTokenFromContext(ctx)
 
 	err := parsedTemplates.ExecuteTemplate(w, templateToExecute, page)
 	if err != nil {
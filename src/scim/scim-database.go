@@ -0,0 +1,216 @@
+package scim
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+const TABLE_QUERY = `CREATE TABLE IF NOT EXISTS scim_groups (
+		id TEXT PRIMARY KEY,
+		external_id TEXT NOT NULL DEFAULT '',
+		display_name TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS scim_group_members (
+		fk_group_id TEXT NOT NULL,
+		fk_user_id TEXT NOT NULL,
+		PRIMARY KEY (fk_group_id, fk_user_id),
+		FOREIGN KEY (fk_group_id) REFERENCES scim_groups(id),
+		FOREIGN KEY (fk_user_id) REFERENCES users(id)
+		);
+		`
+
+var ErrGroupNotFound = errors.New("group not found")
+
+func (sh *ScimHandler) CreateDBTable() error {
+	_, err := sh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating scim tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+type groupRecord struct {
+	ID          string
+	ExternalID  string
+	DisplayName string
+}
+
+type memberRecord struct {
+	UserID    string
+	FUserName string
+}
+
+func (sh *ScimHandler) queryGroups() ([]groupRecord, error) {
+	rows, err := sh.db.Query(`SELECT id, external_id, display_name FROM scim_groups ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []groupRecord
+	for rows.Next() {
+		var group groupRecord
+		if err := rows.Scan(&group.ID, &group.ExternalID, &group.DisplayName); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (sh *ScimHandler) queryGroup(id string) (groupRecord, error) {
+	var group groupRecord
+	err := sh.db.QueryRow(
+		`SELECT id, external_id, display_name FROM scim_groups WHERE id = ?`,
+		id,
+	).Scan(&group.ID, &group.ExternalID, &group.DisplayName)
+	if err == sql.ErrNoRows {
+		return groupRecord{}, ErrGroupNotFound
+	}
+	return group, err
+}
+
+func (sh *ScimHandler) queryMembers(groupID string) ([]memberRecord, error) {
+	rows, err := sh.db.Query(
+		`SELECT m.fk_user_id, u.name
+		 FROM scim_group_members m
+		 JOIN users u ON u.id = m.fk_user_id
+		 WHERE m.fk_group_id = ?
+		 ORDER BY u.name`,
+		groupID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []memberRecord
+	for rows.Next() {
+		var member memberRecord
+		if err := rows.Scan(&member.UserID, &member.FUserName); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// queryExternalGroupIDs returns the external IDs of the groups of a user,
+// for Entra these are the group object IDs the roles are configured with
+func (sh *ScimHandler) queryExternalGroupIDs(userID string) ([]string, error) {
+	rows, err := sh.db.Query(
+		`SELECT g.external_id
+		 FROM scim_group_members m
+		 JOIN scim_groups g ON g.id = m.fk_group_id
+		 WHERE m.fk_user_id = ? AND g.external_id != ''`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+func (sh *ScimHandler) insertGroup(group groupRecord) error {
+	_, err := sh.db.Exec(
+		`INSERT INTO scim_groups (id, external_id, display_name) VALUES (?, ?, ?)`,
+		group.ID, group.ExternalID, group.DisplayName,
+	)
+	return err
+}
+
+func (sh *ScimHandler) updateGroup(group groupRecord) error {
+	_, err := sh.db.Exec(
+		`UPDATE scim_groups SET external_id = ?, display_name = ? WHERE id = ?`,
+		group.ExternalID, group.DisplayName, group.ID,
+	)
+	return err
+}
+
+// displayNameTaken is true if another group has the name
+func (sh *ScimHandler) displayNameTaken(displayName string, groupID string) (bool, error) {
+	var taken bool
+	err := sh.db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM scim_groups WHERE display_name = ? AND id != ?)`,
+		displayName, groupID,
+	).Scan(&taken)
+	return taken, err
+}
+
+// changeMembers replaces the members of a group or,
+// without replace, adds and removes members
+func (sh *ScimHandler) changeMembers(groupID string, replace bool, add []string, remove []string) error {
+	tx, err := sh.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE fk_group_id = ?`, groupID); err != nil {
+			return err
+		}
+	}
+	for _, userID := range add {
+		_, err := tx.Exec(
+			`INSERT OR IGNORE INTO scim_group_members (fk_group_id, fk_user_id)
+			 SELECT ?, id FROM users WHERE id = ?`,
+			groupID, userID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, userID := range remove {
+		_, err := tx.Exec(
+			`DELETE FROM scim_group_members WHERE fk_group_id = ? AND fk_user_id = ?`,
+			groupID, userID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (sh *ScimHandler) deleteGroup(groupID string) error {
+	tx, err := sh.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE fk_group_id = ?`, groupID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM scim_groups WHERE id = ?`, groupID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrGroupNotFound
+	}
+	return tx.Commit()
+}
+
+func (sh *ScimHandler) removeUserFromGroups(userID string) error {
+	_, err := sh.db.Exec(`DELETE FROM scim_group_members WHERE fk_user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,363 @@
+package scim
+
+import (
+	"agora/src/audit"
+	"agora/src/user"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func (sh *ScimHandler) GroupsGETHandler(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	groups, err := sh.queryGroups()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query groups for SCIM", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve groups")
+		return
+	}
+
+	var matching []groupRecord
+	for _, group := range groups {
+		switch filter.Attribute {
+		case "":
+		case "displayname":
+			if !strings.EqualFold(group.DisplayName, filter.Value) {
+				continue
+			}
+		case "externalid":
+			if group.ExternalID != filter.Value {
+				continue
+			}
+		case "id":
+			if group.ID != filter.Value {
+				continue
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "invalidFilter", "Groups can only be filtered by displayName, externalId or id")
+			return
+		}
+		matching = append(matching, group)
+	}
+
+	withMembers := !excludesMembers(r)
+	var resources []any
+	for _, group := range page(matching, startIndex, count) {
+		scimGroup, err := sh.toScimGroup(group, withMembers)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not query members for SCIM", "groupID", group.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "", "Could not retrieve groups")
+			return
+		}
+		resources = append(resources, scimGroup)
+	}
+
+	writeJSON(w, http.StatusOK, listResponse(resources, len(matching), startIndex))
+}
+
+func (sh *ScimHandler) GroupGETHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := sh.existingGroup(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	sh.writeGroup(w, http.StatusOK, group, !excludesMembers(r))
+}
+
+func (sh *ScimHandler) GroupPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	var scimGroup Group
+	if !readJSON(w, r, &scimGroup) {
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not generate group ID", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not create group")
+		return
+	}
+	group := groupRecord{ID: id, ExternalID: scimGroup.ExternalID, DisplayName: scimGroup.DisplayName}
+	if !sh.checkGroup(w, group) {
+		return
+	}
+	if err := sh.insertGroup(group); err != nil {
+		slog.ErrorContext(r.Context(), "could not insert group", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not create group")
+		return
+	}
+	sh.ah.Record(r, "", audit.GroupProvisioned, audit.GroupTarget(group.ID), group.DisplayName)
+
+	if !sh.applyMembers(w, r, group, true, memberIDs(scimGroup.Members), nil) {
+		return
+	}
+	slog.InfoContext(r.Context(), "provisioned group", "groupID", group.ID)
+	sh.writeGroup(w, http.StatusCreated, group, true)
+}
+
+func (sh *ScimHandler) GroupPUTHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := sh.existingGroup(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var scimGroup Group
+	if !readJSON(w, r, &scimGroup) {
+		return
+	}
+	group.ExternalID = scimGroup.ExternalID
+	group.DisplayName = scimGroup.DisplayName
+	if !sh.checkGroup(w, group) {
+		return
+	}
+	if err := sh.updateGroup(group); err != nil {
+		slog.ErrorContext(r.Context(), "could not update group", "groupID", group.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not update group")
+		return
+	}
+
+	if !sh.applyMembers(w, r, group, true, memberIDs(scimGroup.Members), nil) {
+		return
+	}
+	sh.writeGroup(w, http.StatusOK, group, true)
+}
+
+// GroupPATCHHandler answers with 204 like Entra expects,
+// the members of large groups are not sent back
+func (sh *ScimHandler) GroupPATCHHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := sh.existingGroup(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var patch PatchRequest
+	if !readJSON(w, r, &patch) {
+		return
+	}
+
+	replace := false
+	var add, remove []string
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.ToLower(operation.Path)
+
+		if match := memberFilter.FindStringSubmatch(operation.Path); match != nil && op == "remove" {
+			remove = append(remove, match[1])
+			continue
+		}
+
+		switch {
+		case path == "members" && op == "add":
+			add = append(add, valueIDs(operation.Value)...)
+		case path == "members" && op == "remove":
+			remove = append(remove, valueIDs(operation.Value)...)
+		case path == "members" && op == "replace":
+			replace = true
+			add = valueIDs(operation.Value)
+			remove = nil
+		case path == "displayname" && op != "remove":
+			name, ok := stringValue(operation.Value)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "invalidValue", "displayName has to be a string")
+				return
+			}
+			group.DisplayName = name
+		case path == "externalid":
+			group.ExternalID, _ = stringValue(operation.Value)
+		case path == "" && op != "remove":
+			object, ok := operation.Value.(map[string]any)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "noTarget", "Operations without path need an object as value")
+				return
+			}
+			if name, ok := stringValue(object["displayName"]); ok {
+				group.DisplayName = name
+			}
+			if externalID, ok := stringValue(object["externalId"]); ok {
+				group.ExternalID = externalID
+			}
+			if members, ok := object["members"]; ok {
+				add = append(add, valueIDs(members)...)
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "invalidPath", "Unsupported operation "+operation.Op+" on "+operation.Path)
+			return
+		}
+	}
+
+	if !sh.checkGroup(w, group) {
+		return
+	}
+	if err := sh.updateGroup(group); err != nil {
+		slog.ErrorContext(r.Context(), "could not update group", "groupID", group.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not update group")
+		return
+	}
+	if !sh.applyMembers(w, r, group, replace, add, remove) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *ScimHandler) GroupDELETEHandler(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["id"]
+	err := sh.deleteGroup(groupID)
+	if err == ErrGroupNotFound {
+		writeError(w, http.StatusNotFound, "", "Group "+groupID+" not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not delete group", "groupID", groupID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not delete group")
+		return
+	}
+	sh.ah.Record(r, "", audit.GroupDeleted, audit.GroupTarget(groupID), "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *ScimHandler) existingGroup(w http.ResponseWriter, id string) (groupRecord, bool) {
+	group, err := sh.queryGroup(id)
+	if err == ErrGroupNotFound {
+		writeError(w, http.StatusNotFound, "", "Group "+id+" not found")
+		return groupRecord{}, false
+	}
+	if err != nil {
+		slog.Error("could not query group for SCIM", "groupID", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve group")
+		return groupRecord{}, false
+	}
+	return group, true
+}
+
+func (sh *ScimHandler) checkGroup(w http.ResponseWriter, group groupRecord) bool {
+	if group.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return false
+	}
+	taken, err := sh.displayNameTaken(group.DisplayName, group.ID)
+	if err != nil {
+		slog.Error("could not check group name", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not save group")
+		return false
+	}
+	if taken {
+		writeError(w, http.StatusConflict, "uniqueness", "Another group is called "+group.DisplayName)
+		return false
+	}
+	return true
+}
+
+// applyMembers changes the members and grants the roles
+// configured for the group to the new members.
+// Unknown user IDs are ignored, the user may be provisioned later
+func (sh *ScimHandler) applyMembers(w http.ResponseWriter, r *http.Request, group groupRecord, replace bool, add []string, remove []string) bool {
+	if !replace && len(add) == 0 && len(remove) == 0 {
+		return true
+	}
+	if err := sh.changeMembers(group.ID, replace, add, remove); err != nil {
+		slog.ErrorContext(r.Context(), "could not change members of group", "groupID", group.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not change members")
+		return false
+	}
+	sh.ah.Record(r, "", audit.GroupMembersChanged, audit.GroupTarget(group.ID),
+		"added="+strings.Join(add, ",")+" removed="+strings.Join(remove, ","))
+
+	for _, userID := range add {
+		groups, err := sh.queryExternalGroupIDs(userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not query groups of user", "userID", userID, "err", err)
+			continue
+		}
+		role, granted, err := sh.uh.LoginRole(userID, groups)
+		if err == user.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not grant group role", "userID", userID, "err", err)
+			continue
+		}
+		if granted {
+			sh.ah.Record(r, "", audit.RoleChanged, audit.UserTarget(userID), "role="+role+" granted by group "+group.DisplayName)
+		}
+	}
+	return true
+}
+
+func (sh *ScimHandler) writeGroup(w http.ResponseWriter, status int, group groupRecord, withMembers bool) {
+	scimGroup, err := sh.toScimGroup(group, withMembers)
+	if err != nil {
+		slog.Error("could not query members for SCIM", "groupID", group.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve group")
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", scimGroup.Meta.Location)
+	}
+	writeJSON(w, status, scimGroup)
+}
+
+func (sh *ScimHandler) toScimGroup(group groupRecord, withMembers bool) (Group, error) {
+	scimGroup := Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          group.ID,
+		ExternalID:  group.ExternalID,
+		DisplayName: group.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Location:     sh.baseURL + "/scim/v2/Groups/" + group.ID,
+		},
+	}
+	if !withMembers {
+		return scimGroup, nil
+	}
+
+	members, err := sh.queryMembers(group.ID)
+	if err != nil {
+		return Group{}, err
+	}
+	for _, member := range members {
+		scimGroup.Members = append(scimGroup.Members, Member{
+			Value:   member.UserID,
+			Display: member.FUserName,
+			Ref:     sh.baseURL + "/scim/v2/Users/" + member.UserID,
+		})
+	}
+	return scimGroup, nil
+}
+
+// excludesMembers is true for ?excludedAttributes=members,
+// Entra asks like this to skip large member lists
+func excludesMembers(r *http.Request) bool {
+	for _, attribute := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func memberIDs(members []Member) []string {
+	var ids []string
+	for _, member := range members {
+		ids = append(ids, member.Value)
+	}
+	return ids
+}
+
+// valueIDs reads the user IDs of a members value like [{"value": "id"}]
+func valueIDs(value any) []string {
+	list, _ := value.([]any)
+	var ids []string
+	for _, item := range list {
+		object, _ := item.(map[string]any)
+		if id, ok := stringValue(object["value"]); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
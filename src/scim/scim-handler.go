@@ -0,0 +1,45 @@
+package scim
+
+import (
+	"agora/src/audit"
+	"agora/src/db"
+	"agora/src/user"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ScimHandler lets the identity provider create, update and deactivate
+// users and groups, it is authenticated with a shared bearer secret
+type ScimHandler struct {
+	db      *db.DB
+	uh      *user.UserHandler
+	ah      *audit.AuditHandler
+	secret  string
+	baseURL string
+}
+
+func NewScimHandler(db *db.DB, uh *user.UserHandler, ah *audit.AuditHandler, secret string, baseURL string) *ScimHandler {
+	return &ScimHandler{
+		db:      db,
+		uh:      uh,
+		ah:      ah,
+		secret:  secret,
+		baseURL: baseURL,
+	}
+}
+
+// Middleware rejects requests without the bearer secret,
+// SCIM requests never have a login cookie
+func (sh *ScimHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || sh.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(sh.secret)) != 1 {
+			slog.WarnContext(r.Context(), "rejected SCIM request without valid secret", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, "", "Missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package scim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func (sh *ScimHandler) ServiceProviderConfigGETHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{SchemaProviderConf},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxResults},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The shared secret configured as SCIM_SECRET",
+			"primary":     true,
+		}},
+		"meta": Meta{ResourceType: "ServiceProviderConfig", Location: sh.baseURL + "/scim/v2/ServiceProviderConfig"},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("could not write SCIM response", "err", err)
+	}
+}
+
+// writeError answers in the error format of SCIM,
+// scimType is one of the detail error keywords of RFC 7644, e.g. uniqueness
+func writeError(w http.ResponseWriter, status int, scimType string, detail string) {
+	writeJSON(w, status, Error{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, body any) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "Invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// listParams reads the filter, startIndex and count of a list request,
+// count is capped at maxResults
+func listParams(r *http.Request) (filter Filter, startIndex int, count int, err error) {
+	query := r.URL.Query()
+	filter, err = parseFilter(query.Get("filter"))
+	if err != nil {
+		return Filter{}, 0, 0, err
+	}
+
+	startIndex, count = 1, -1
+	if value := query.Get("startIndex"); value != "" {
+		startIndex, err = strconv.Atoi(value)
+		if err != nil {
+			return Filter{}, 0, 0, err
+		}
+	}
+	if value := query.Get("count"); value != "" {
+		count, err = strconv.Atoi(value)
+		if err != nil {
+			return Filter{}, 0, 0, err
+		}
+	}
+	if count < 0 || count > maxResults {
+		count = maxResults
+	}
+	return filter, startIndex, count, nil
+}
+
+func listResponse(resources []any, total int, startIndex int) ListResponse {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if resources == nil {
+		resources = []any{}
+	}
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
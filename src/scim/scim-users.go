@@ -0,0 +1,405 @@
+package scim
+
+import (
+	"agora/src/audit"
+	"agora/src/user"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func (sh *ScimHandler) UsersGETHandler(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	profiles, err := sh.uh.QueryProfiles()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query users for SCIM", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve users")
+		return
+	}
+
+	var matching []user.Profile
+	for _, profile := range profiles {
+		switch filter.Attribute {
+		case "":
+		case "username", "emails.value":
+			if !strings.EqualFold(profile.Email, filter.Value) {
+				continue
+			}
+		case "id", "externalid":
+			if profile.ID != filter.Value {
+				continue
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "invalidFilter", "Users can only be filtered by userName, externalId or id")
+			return
+		}
+		matching = append(matching, profile)
+	}
+
+	var resources []any
+	for _, profile := range page(matching, startIndex, count) {
+		scimUser, err := sh.toScimUser(profile)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not query suspension for SCIM", "userID", profile.ID, "err", err)
+			writeError(w, http.StatusInternalServerError, "", "Could not retrieve users")
+			return
+		}
+		resources = append(resources, scimUser)
+	}
+
+	writeJSON(w, http.StatusOK, listResponse(resources, len(matching), startIndex))
+}
+
+func (sh *ScimHandler) UserGETHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := sh.existingProfile(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	sh.writeUser(w, http.StatusOK, profile)
+}
+
+// UserPOSTHandler provisions a user. The externalId becomes the
+// Agora user ID, it has to be the Entra object ID so the user
+// keeps their account when they log in
+func (sh *ScimHandler) UserPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	var scimUser User
+	if !readJSON(w, r, &scimUser) {
+		return
+	}
+	if scimUser.ExternalID == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "externalId is required, map it to the object ID of the user")
+		return
+	}
+	if scimUser.UserName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	_, err := sh.uh.QueryProfile(scimUser.ExternalID)
+	if err == nil {
+		writeError(w, http.StatusConflict, "uniqueness", "A user with this externalId already exists")
+		return
+	}
+	if err != user.ErrUserNotFound {
+		slog.ErrorContext(r.Context(), "could not query user for SCIM", "userID", scimUser.ExternalID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not create user")
+		return
+	}
+
+	profile := user.Profile{ID: scimUser.ExternalID}
+	applyUser(&profile, scimUser)
+	if !sh.saveProfile(w, profile) {
+		return
+	}
+	if scimUser.Active != nil && !*scimUser.Active && !sh.setActive(w, r, profile.ID, false) {
+		return
+	}
+
+	sh.ah.Record(r, "", audit.UserProvisioned, audit.UserTarget(profile.ID), "SCIM userName="+scimUser.UserName)
+	slog.InfoContext(r.Context(), "provisioned user", "userID", profile.ID)
+	sh.writeUser(w, http.StatusCreated, profile)
+}
+
+// UserPUTHandler replaces the attributes SCIM knows about,
+// the office location is only synced at login and stays
+func (sh *ScimHandler) UserPUTHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := sh.existingProfile(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var scimUser User
+	if !readJSON(w, r, &scimUser) {
+		return
+	}
+	if scimUser.UserName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	applyUser(&profile, scimUser)
+	if !sh.saveProfile(w, profile) {
+		return
+	}
+	if scimUser.Active != nil && !sh.setActive(w, r, profile.ID, *scimUser.Active) {
+		return
+	}
+	sh.writeUser(w, http.StatusOK, profile)
+}
+
+func (sh *ScimHandler) UserPATCHHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := sh.existingProfile(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var patch PatchRequest
+	if !readJSON(w, r, &patch) {
+		return
+	}
+
+	var active *bool
+	for _, operation := range patch.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			writeError(w, http.StatusBadRequest, "invalidSyntax", "Unknown operation "+operation.Op)
+			return
+		}
+
+		// without a path the value holds the attributes
+		values := map[string]any{}
+		if operation.Path == "" {
+			object, ok := operation.Value.(map[string]any)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "noTarget", "Operations without path need an object as value")
+				return
+			}
+			values = object
+		} else {
+			values[operation.Path] = operation.Value
+		}
+
+		for path, value := range values {
+			if op == "remove" {
+				value = ""
+			}
+			if strings.EqualFold(path, "active") {
+				isActive, ok := boolValue(value)
+				if !ok {
+					writeError(w, http.StatusBadRequest, "invalidValue", "active has to be a boolean")
+					return
+				}
+				active = &isActive
+				continue
+			}
+			if err := patchProfile(&profile, path, value); err != nil {
+				writeError(w, http.StatusBadRequest, "invalidPath", err.Error())
+				return
+			}
+		}
+	}
+
+	if profile.Email == "" || profile.Name == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName and displayName cannot be removed")
+		return
+	}
+	if !sh.saveProfile(w, profile) {
+		return
+	}
+	if active != nil && !sh.setActive(w, r, profile.ID, *active) {
+		return
+	}
+	sh.writeUser(w, http.StatusOK, profile)
+}
+
+// UserDELETEHandler deactivates the user, their posts
+// and comments stay so the threads remain readable
+func (sh *ScimHandler) UserDELETEHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := sh.existingProfile(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if !sh.setActive(w, r, profile.ID, false) {
+		return
+	}
+	if err := sh.removeUserFromGroups(profile.ID); err != nil {
+		slog.ErrorContext(r.Context(), "could not remove user from groups", "userID", profile.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not delete user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (sh *ScimHandler) existingProfile(w http.ResponseWriter, id string) (user.Profile, bool) {
+	profile, err := sh.uh.QueryProfile(id)
+	if err == user.ErrUserNotFound {
+		writeError(w, http.StatusNotFound, "", "User "+id+" not found")
+		return user.Profile{}, false
+	}
+	if err != nil {
+		slog.Error("could not query user for SCIM", "userID", id, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve user")
+		return user.Profile{}, false
+	}
+	return profile, true
+}
+
+// saveProfile refuses emails of other users,
+// a login would take the email over instead
+func (sh *ScimHandler) saveProfile(w http.ResponseWriter, profile user.Profile) bool {
+	profiles, err := sh.uh.QueryProfiles()
+	if err != nil {
+		slog.Error("could not query users for SCIM", "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not save user")
+		return false
+	}
+	for _, other := range profiles {
+		if other.ID != profile.ID && strings.EqualFold(other.Email, profile.Email) {
+			writeError(w, http.StatusConflict, "uniqueness", "Another user has the email "+profile.Email)
+			return false
+		}
+	}
+
+	if err := sh.uh.SyncProfile(profile); err != nil {
+		writeError(w, http.StatusInternalServerError, "", "Could not save user")
+		return false
+	}
+	return true
+}
+
+// setActive suspends deactivated users and logs them out everywhere
+func (sh *ScimHandler) setActive(w http.ResponseWriter, r *http.Request, userID string, active bool) bool {
+	suspension, err := sh.uh.QuerySuspension(userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query suspension for SCIM", "userID", userID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not update user")
+		return false
+	}
+	if suspension.Suspended != active {
+		return true
+	}
+
+	if active {
+		err = sh.uh.Unsuspend(userID)
+	} else {
+		err = sh.uh.Suspend(userID, time.Time{})
+		if err == nil {
+			err = sh.uh.RevokeSessions(userID)
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not change active state", "userID", userID, "active", active, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not update user")
+		return false
+	}
+
+	action := audit.UserEnabled
+	if !active {
+		action = audit.UserDisabled
+	}
+	sh.ah.Record(r, "", action, audit.UserTarget(userID), "by SCIM")
+	slog.InfoContext(r.Context(), "changed user", "action", action, "userID", userID, "by", "scim")
+	return true
+}
+
+func (sh *ScimHandler) writeUser(w http.ResponseWriter, status int, profile user.Profile) {
+	scimUser, err := sh.toScimUser(profile)
+	if err != nil {
+		slog.Error("could not query suspension for SCIM", "userID", profile.ID, "err", err)
+		writeError(w, http.StatusInternalServerError, "", "Could not retrieve user")
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", scimUser.Meta.Location)
+	}
+	writeJSON(w, status, scimUser)
+}
+
+func (sh *ScimHandler) toScimUser(profile user.Profile) (User, error) {
+	suspension, err := sh.uh.QuerySuspension(profile.ID)
+	if err != nil {
+		return User{}, err
+	}
+	active := !suspension.Suspended
+
+	return User{
+		Schemas:     []string{SchemaUser},
+		ID:          profile.ID,
+		ExternalID:  profile.ID,
+		UserName:    profile.Email,
+		DisplayName: profile.Name,
+		Name: &Name{
+			GivenName:  profile.GivenName,
+			FamilyName: profile.Surname,
+			Formatted:  profile.Name,
+		},
+		Title:  profile.JobTitle,
+		Emails: []Email{{Value: profile.Email, Type: "work", Primary: true}},
+		Active: &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Location:     sh.baseURL + "/scim/v2/Users/" + profile.ID,
+		},
+	}, nil
+}
+
+// applyUser copies the attributes of a SCIM user to the profile,
+// the primary email wins over the userName like at login
+func applyUser(profile *user.Profile, scimUser User) {
+	profile.Email = scimUser.UserName
+	for _, email := range scimUser.Emails {
+		if email.Primary && email.Value != "" {
+			profile.Email = email.Value
+		}
+	}
+
+	profile.Name = scimUser.DisplayName
+	profile.GivenName = ""
+	profile.Surname = ""
+	if scimUser.Name != nil {
+		profile.GivenName = scimUser.Name.GivenName
+		profile.Surname = scimUser.Name.FamilyName
+		if profile.Name == "" {
+			profile.Name = scimUser.Name.Formatted
+		}
+	}
+	if profile.Name == "" {
+		profile.Name = scimUser.UserName
+	}
+	profile.JobTitle = scimUser.Title
+}
+
+// patchProfile sets one attribute path of a PATCH operation
+func patchProfile(profile *user.Profile, path string, value any) error {
+	if strings.EqualFold(path, "name") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			object = map[string]any{}
+		}
+		for subPath, subValue := range object {
+			if err := patchProfile(profile, "name."+subPath, subValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	text, ok := stringValue(value)
+	if !ok {
+		// Entra sends single valued attributes like emails as a list
+		if list, isList := value.([]any); isList && len(list) > 0 {
+			if object, isObject := list[0].(map[string]any); isObject {
+				text, ok = stringValue(object["value"])
+			}
+		}
+	}
+	if !ok {
+		return errInvalidValue(path)
+	}
+
+	switch strings.ToLower(path) {
+	case "username", "emails", `emails[type eq "work"].value`:
+		profile.Email = text
+	case "displayname", "name.formatted":
+		profile.Name = text
+	case "name.givenname":
+		profile.GivenName = text
+	case "name.familyname":
+		profile.Surname = text
+	case "title":
+		profile.JobTitle = text
+	case "externalid":
+		// the externalId is the ID and cannot change
+	default:
+		return errUnknownPath(path)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package scim
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaProviderConf = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+const contentType = "application/scim+json"
+
+// maxResults caps the count of a list request
+const maxResults = 200
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type Name struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	Formatted  string `json:"formatted,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// User is the SCIM view of an Agora user,
+// userName is the email and the ID is the Entra object ID
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Name        *Name    `json:"name,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	// Active is a pointer so a missing value can be told apart from false
+	Active *bool `json:"active,omitempty"`
+	Meta   *Meta `json:"meta,omitempty"`
+}
+
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation values stay raw JSON,
+// their type depends on the path
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// Filter is the only filter form clients like Entra use: attribute eq "value"
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-zA-Z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter returns an empty filter for an empty expression
+func parseFilter(expression string) (Filter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return Filter{}, nil
+	}
+	match := filterPattern.FindStringSubmatch(expression)
+	if match == nil {
+		return Filter{}, fmt.Errorf("only filters like userName eq \"value\" are supported")
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return Filter{}, err
+	}
+	return Filter{Attribute: strings.ToLower(match[1]), Value: value}, nil
+}
+
+// memberFilter reads the ID of paths like members[value eq "id"]
+var memberFilter = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+// boolValue accepts JSON booleans and the strings Entra sends, e.g. "False"
+func boolValue(value any) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		return b, err == nil
+	}
+	return false, false
+}
+
+func stringValue(value any) (string, bool) {
+	s, ok := value.(string)
+	return s, ok
+}
+
+// page cuts a list to the 1-based startIndex and count of a list request
+func page[T any](items []T, startIndex int, count int) []T {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if startIndex > len(items) {
+		return nil
+	}
+	items = items[startIndex-1:]
+	if count >= 0 && count < len(items) {
+		items = items[:count]
+	}
+	return items
+}
+
+func errInvalidValue(path string) error {
+	return fmt.Errorf("invalid value for %s", path)
+}
+
+func errUnknownPath(path string) error {
+	return fmt.Errorf("attribute %s is not supported", path)
+}
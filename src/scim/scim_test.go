@@ -0,0 +1,248 @@
+package scim
+
+import (
+	"agora/src/audit"
+	"agora/src/db/dbtest"
+	"agora/src/user"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const testSecret = "test-secret"
+
+type scimTest struct {
+	t      *testing.T
+	router *mux.Router
+	uh     *user.UserHandler
+	ah     *audit.AuditHandler
+}
+
+// newScimTest routes the user endpoints like the server does
+func newScimTest(t *testing.T) *scimTest {
+	database := dbtest.Open(t)
+	uh := user.NewUserHandler(database, nil, nil, nil, nil)
+	ah := audit.NewAuditHandler(database)
+	sh := NewScimHandler(database, uh, ah, testSecret, "http://agora.test")
+	dbtest.Migrate(t, uh.CreateDBTable, ah.CreateDBTable, sh.CreateDBTable)
+
+	router := mux.NewRouter()
+	scimRouter := router.PathPrefix("/scim/v2").Subrouter()
+	scimRouter.Use(sh.Middleware)
+	scimRouter.HandleFunc("/Users", sh.UsersGETHandler).Methods("GET")
+	scimRouter.HandleFunc("/Users", sh.UserPOSTHandler).Methods("POST")
+	scimRouter.HandleFunc("/Users/{id}", sh.UserPATCHHandler).Methods("PATCH")
+	scimRouter.HandleFunc("/Users/{id}", sh.UserDELETEHandler).Methods("DELETE")
+
+	return &scimTest{t: t, router: router, uh: uh, ah: ah}
+}
+
+// request sends an authenticated SCIM request, the body of the
+// response is decoded unless it is empty
+func (st *scimTest) request(method string, path string, body string) (*httptest.ResponseRecorder, map[string]any) {
+	st.t.Helper()
+
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testSecret)
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	st.router.ServeHTTP(recorder, request)
+
+	var response map[string]any
+	if recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			st.t.Fatalf("%s %s: response is not json: %v\n%s", method, path, err, recorder.Body)
+		}
+	}
+	return recorder, response
+}
+
+func (st *scimTest) createUser(id string, email string) {
+	st.t.Helper()
+
+	body := `{"schemas": ["` + SchemaUser + `"], "externalId": "` + id + `", "userName": "` + email + `",
+		"name": {"givenName": "Alice", "familyName": "Example"}, "active": true}`
+	if recorder, response := st.request("POST", "/scim/v2/Users", body); recorder.Code != http.StatusCreated {
+		st.t.Fatalf("could not create %s: %d %v", id, recorder.Code, response)
+	}
+}
+
+func (st *scimTest) countAudit(action audit.Action, userID string) int {
+	st.t.Helper()
+
+	entries, err := st.ah.QueryEntries(audit.Filter{Action: action, TargetType: "user", TargetID: userID}, 0)
+	if err != nil {
+		st.t.Fatalf("could not query audit log: %v", err)
+	}
+	return len(entries)
+}
+
+func TestCreateUserTakesExternalIDAsID(t *testing.T) {
+	st := newScimTest(t)
+
+	recorder, created := st.request("POST", "/scim/v2/Users", `{
+		"externalId": "entra-1",
+		"userName": "alice@example.com",
+		"emails": [{"value": "alice.work@example.com", "primary": true}],
+		"name": {"formatted": "Alice Example"}
+	}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %v", recorder.Code, created)
+	}
+	if created["id"] != "entra-1" || recorder.Header().Get("Location") != "http://agora.test/scim/v2/Users/entra-1" {
+		t.Errorf("the externalId should become the id: %v, Location %s", created, recorder.Header().Get("Location"))
+	}
+
+	profile, err := st.uh.QueryProfile("entra-1")
+	if err != nil {
+		t.Fatalf("created user is not stored: %v", err)
+	}
+	if profile.Email != "alice.work@example.com" || profile.Name != "Alice Example" {
+		t.Errorf("primary email and formatted name should win: %+v", profile)
+	}
+	if st.countAudit(audit.UserProvisioned, "entra-1") != 1 {
+		t.Error("provisioning should be audited")
+	}
+
+	for _, test := range []struct {
+		body     string
+		status   int
+		scimType string
+	}{
+		{`{"externalId": "entra-1", "userName": "other@example.com"}`, http.StatusConflict, "uniqueness"},
+		{`{"externalId": "entra-2", "userName": "ALICE.WORK@example.com"}`, http.StatusConflict, "uniqueness"},
+		{`{"userName": "bob@example.com"}`, http.StatusBadRequest, "invalidValue"},
+		{`{"externalId": "entra-3"}`, http.StatusBadRequest, "invalidValue"},
+		{`{"externalId": `, http.StatusBadRequest, "invalidSyntax"},
+	} {
+		recorder, response := st.request("POST", "/scim/v2/Users", test.body)
+		if recorder.Code != test.status || response["scimType"] != test.scimType {
+			t.Errorf("%s: expected %d %s, got %d %v", test.body, test.status, test.scimType, recorder.Code, response)
+		}
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	st := newScimTest(t)
+	st.createUser("entra-1", "alice@example.com")
+
+	// Entra sends booleans as capitalized strings
+	deactivate := `{"schemas": ["` + SchemaPatchOp + `"], "Operations": [{"op": "Replace", "path": "active", "value": "False"}]}`
+
+	recorder, patched := st.request("PATCH", "/scim/v2/Users/entra-1", deactivate)
+	if recorder.Code != http.StatusOK || patched["active"] != false {
+		t.Fatalf("user should be inactive: %d %v", recorder.Code, patched)
+	}
+
+	suspension, err := st.uh.QuerySuspension("entra-1")
+	if err != nil {
+		t.Fatalf("could not query suspension: %v", err)
+	}
+	if !suspension.Suspended || !suspension.Until.IsZero() {
+		t.Errorf("deactivated user should be suspended without end: %+v", suspension)
+	}
+	if revokedAt, _ := st.uh.SessionsRevokedAt("entra-1"); revokedAt.IsZero() {
+		t.Error("deactivating should log the user out everywhere")
+	}
+
+	// Entra repeats deactivations, and deletes users it deactivated before
+	recorder, patched = st.request("PATCH", "/scim/v2/Users/entra-1", deactivate)
+	if recorder.Code != http.StatusOK || patched["active"] != false {
+		t.Errorf("deactivating again should succeed: %d %v", recorder.Code, patched)
+	}
+	if recorder, _ := st.request("DELETE", "/scim/v2/Users/entra-1", ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("deleting a deactivated user should succeed, got %d", recorder.Code)
+	}
+	if count := st.countAudit(audit.UserDisabled, "entra-1"); count != 1 {
+		t.Errorf("only the first deactivation changes anything, got %d audit entries", count)
+	}
+
+	recorder, patched = st.request("PATCH", "/scim/v2/Users/entra-1", `{"Operations": [{"op": "replace", "value": {"active": true}}]}`)
+	if recorder.Code != http.StatusOK || patched["active"] != true {
+		t.Errorf("user should be active again: %d %v", recorder.Code, patched)
+	}
+	if st.countAudit(audit.UserEnabled, "entra-1") != 1 {
+		t.Error("reactivation should be audited")
+	}
+
+	recorder, response := st.request("PATCH", "/scim/v2/Users/entra-1", `{"Operations": [{"op": "replace", "path": "active", "value": "maybe"}]}`)
+	if recorder.Code != http.StatusBadRequest || response["scimType"] != "invalidValue" {
+		t.Errorf("active has to be a boolean: %d %v", recorder.Code, response)
+	}
+}
+
+func TestFilterUsers(t *testing.T) {
+	st := newScimTest(t)
+	st.createUser("entra-1", "alice@example.com")
+	st.createUser("entra-2", "bob@example.com")
+
+	list := func(query string) (int, map[string]any) {
+		t.Helper()
+		recorder, response := st.request("GET", "/scim/v2/Users?"+query, "")
+		return recorder.Code, response
+	}
+
+	for filter, wantID := range map[string]string{
+		`userName eq "BOB@example.com"`:     "entra-2",
+		`USERNAME EQ "alice@example.com"`:   "entra-1",
+		`externalId eq "entra-1"`:           "entra-1",
+		`emails.value eq "bob@example.com"`: "entra-2",
+	} {
+		status, response := list("filter=" + url.QueryEscape(filter))
+		resources, _ := response["Resources"].([]any)
+		if status != http.StatusOK || response["totalResults"] != 1.0 || len(resources) != 1 {
+			t.Errorf("%s: expected one user, got %d %v", filter, status, response)
+			continue
+		}
+		if id := resources[0].(map[string]any)["id"]; id != wantID {
+			t.Errorf("%s: expected %s, got %v", filter, wantID, id)
+		}
+	}
+
+	status, response := list("filter=" + url.QueryEscape(`userName eq "nobody \"quoted\"@example.com"`))
+	if status != http.StatusOK || response["totalResults"] != 0.0 {
+		t.Errorf("escaped quotes should parse and match nobody: %d %v", status, response)
+	}
+}
+
+func TestFilterParseErrors(t *testing.T) {
+	st := newScimTest(t)
+	st.createUser("entra-1", "alice@example.com")
+
+	for _, query := range []string{
+		"filter=" + url.QueryEscape(`userName eq alice@example.com`),
+		"filter=" + url.QueryEscape(`userName co "alice"`),
+		"filter=" + url.QueryEscape(`userName eq "alice@example.com" and active eq "true"`),
+		"filter=" + url.QueryEscape(`displayName eq "Alice"`),
+		"filter=" + url.QueryEscape(`userName eq "unterminated`),
+		"startIndex=first",
+		"count=all",
+	} {
+		recorder, response := st.request("GET", "/scim/v2/Users?"+query, "")
+		if recorder.Code != http.StatusBadRequest || response["scimType"] != "invalidFilter" {
+			t.Errorf("%s: expected invalidFilter, got %d %v", query, recorder.Code, response)
+		}
+	}
+}
+
+func TestRequestsNeedTheSecret(t *testing.T) {
+	st := newScimTest(t)
+
+	for _, authorization := range []string{"", "Bearer wrong", testSecret, "Basic " + testSecret} {
+		request := httptest.NewRequest("GET", "/scim/v2/Users", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		st.router.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("authorization %q: expected 401, got %d", authorization, recorder.Code)
+		}
+	}
+}
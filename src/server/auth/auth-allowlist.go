@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// AllowList restricts who can sign in, an empty list does not restrict.
+// A user has to pass every list that is configured,
+// e.g. be in one of the tenants and in one of the groups
+type AllowList struct {
+	// EmailDomains like "example.com", subdomains are not included
+	EmailDomains []string
+	TenantIDs    []string
+	// Groups are the object IDs of Entra groups
+	Groups []string
+}
+
+// Identity is what the allow list and the role mapping
+// know about the user signing in
+type Identity struct {
+	Email    string
+	TenantID string
+	Groups   []string
+}
+
+// deniedReason is empty if the identity is allowed to sign in
+func (al AllowList) deniedReason(identity Identity) string {
+	if len(al.EmailDomains) > 0 && !containsFold(al.EmailDomains, emailDomain(identity.Email)) {
+		return "email domain not allowed"
+	}
+	if len(al.TenantIDs) > 0 && !containsFold(al.TenantIDs, identity.TenantID) {
+		return "tenant not allowed"
+	}
+	if len(al.Groups) > 0 && !slices.ContainsFunc(identity.Groups, func(group string) bool {
+		return containsFold(al.Groups, group)
+	}) {
+		return "not in an allowed group"
+	}
+	return ""
+}
+
+func (al AllowList) needsGroups() bool {
+	return len(al.Groups) > 0
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return email[at+1:]
+}
+
+func containsFold(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	return slices.ContainsFunc(values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
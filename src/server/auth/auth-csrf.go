@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"agora/src/user"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+)
+
+// CSRFField is the name of the hidden input every form sends the token in,
+// requests without a form can send it in the CSRFHeader instead
+const (
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+type csrfTokenKey struct{}
+
+// CSRFMiddleware checks the token of requests that change something.
+// The token is derived from the login cookie, so it changes with every
+// login and another site cannot know it. Requests without a logged in
+// user are not checked, without the cookie there is nothing to forge.
+// It has to run after Middleware.
+func (ah *AuthHandler) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, loggedIn := r.Context().Value("user").(user.User)
+		cookie, err := r.Cookie("token")
+		if !loggedIn || err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := ah.csrfToken(cookie.Value)
+		ctx := context.WithValue(r.Context(), csrfTokenKey{}, token)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		sent := r.Header.Get(CSRFHeader)
+		if sent == "" {
+			sent = r.PostFormValue(CSRFField)
+		}
+		if !hmac.Equal([]byte(sent), []byte(token)) {
+			slog.WarnContext(r.Context(), "rejected request without valid CSRF token", "method", r.Method, "path", r.URL.Path, "tokenSent", sent != "")
+			http.Error(w, "This form has expired, please reload the page and try again", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CSRFTokenFromContext is the token for the forms of the page,
+// empty without a logged in user
+func CSRFTokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(csrfTokenKey{}).(string)
+	return token
+}
+
+func (ah *AuthHandler) csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(ah.jwtSecret))
+	mac.Write([]byte("csrf:" + sessionToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
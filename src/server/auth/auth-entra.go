@@ -1,10 +1,13 @@
 package auth
 
 import (
-	"agora/src/log"
+	"agora/src/audit"
+	"agora/src/user"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -21,54 +24,176 @@ func (ah *AuthHandler) HandleLoginCallback(w http.ResponseWriter, r *http.Reques
 	code := r.URL.Query().Get("code")
 	token, err := ah.oauthConfig.Exchange(context.Background(), code)
 	if err != nil {
-		http.Error(w, "Failed to exchange token: "+err.Error(), http.StatusInternalServerError)
+		ah.failLogin(w, r, "Failed to exchange token", err)
 		return
 	}
 
 	client := ah.oauthConfig.Client(context.Background(), token)
 	resp, err := client.Get("https://graph.microsoft.com/v1.0/me")
 	if err != nil {
-		http.Error(w, "Failed to get user info: "+err.Error(), http.StatusInternalServerError)
+		ah.failLogin(w, r, "Failed to get user info", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "Failed to read user info: "+err.Error(), http.StatusInternalServerError)
+		ah.failLogin(w, r, "Failed to read user info", err)
 		return
 	}
 
 	// Unmarshal the JSON data into the MSGraphUser struct
 	var user MSGraphUser
 	if err := json.Unmarshal(data, &user); err != nil {
-		http.Error(w, "Failed to parse user info: "+err.Error(), http.StatusInternalServerError)
+		ah.failLogin(w, r, "Failed to parse user info", err)
 		return
 	}
 
-	if !ah.userHandler.UserExists(user.ID) {
-		ah.userHandler.AddUser(user.ID, user.DisplayName, user.Mail)
+	identity, err := ah.identityOf(client, token, user)
+	if err != nil {
+		ah.failLogin(w, r, "Failed to read group memberships", err)
+		return
+	}
+	if reason := ah.allowList.deniedReason(identity); reason != "" {
+		// there is no users row for the actor, denied users are not added
+		ah.auditHandler.Record(r, "", audit.LoginFailed, audit.UserTarget(user.ID), reason+" email="+identity.Email+" tenant="+identity.TenantID)
+		slog.InfoContext(r.Context(), "denied sign in", "userID", user.ID, "email", identity.Email, "tenantID", identity.TenantID, "reason", reason)
+		renderDenied(w, r, identity.Email)
+		return
+	}
+
+	profile := user.profile()
+	profile.Email = identity.Email
+	if err := ah.userHandler.SyncProfile(profile); err != nil {
+		ah.failLogin(w, r, "Failed to save user profile", err)
+		return
+	}
+
+	suspension, err := ah.userHandler.QuerySuspension(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not check if user is suspended", "userID", user.ID, "err", err)
+		http.Error(w, "Could not log in, please try again", http.StatusInternalServerError)
+		return
+	}
+	if suspension.Suspended {
+		ah.auditHandler.Record(r, user.ID, audit.LoginFailed, audit.UserTarget(user.ID), "account suspended")
+		ah.renderSuspended(w, r, suspension)
+		return
 	}
 
-	newToken, jwtString := ah.createJWT(user.ID, user.DisplayName, user.Mail, ah.issuer)
+	role, granted, err := ah.userHandler.LoginRole(user.ID, identity.Groups)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not determine role, continuing as regular user", "userID", user.ID, "err", err)
+	}
+	if granted {
+		ah.auditHandler.Record(r, user.ID, audit.RoleChanged, audit.UserTarget(user.ID), "role="+role+" granted by configuration")
+	}
+	ah.auditHandler.Record(r, user.ID, audit.Login, audit.UserTarget(user.ID), "")
+	if err := ah.userHandler.RecordLogin(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "could not record login", "userID", user.ID, "err", err)
+	}
+
+	newToken, jwtString := ah.createJWT(user.ID, profile.Name, profile.Email, role, ah.issuer)
 	expiry, err := newToken.Claims.GetExpirationTime()
 	if err != nil {
-		log.Error.Printf("Failed to get expiration time from JWT claims: %v\n", err)
+		slog.ErrorContext(r.Context(), "failed to get expiration time from JWT claims", "err", err)
 		// Fallback to 1 hour from now if we can't extract expiration
 		expiry = jwt.NewNumericDate(time.Now().Add(time.Hour * 1))
 	}
 
-	cookie := makeCookieOutOfOAuthToken(jwtString, expiry.Time)
+	cookie := ah.makeCookieOutOfOAuthToken(jwtString, expiry.Time)
 	http.SetCookie(w, &cookie)
 	http.Redirect(w, r, "/", http.StatusPermanentRedirect)
 }
 
-func makeCookieOutOfOAuthToken(tokenString string, expiry time.Time) http.Cookie {
+// identityOf reads the tenant and the groups from the ID token.
+// Groups are only looked up when needed, if the token has no groups claim,
+// e.g. because the user is in too many groups, they are read from Graph
+func (ah *AuthHandler) identityOf(client *http.Client, token *oauth2.Token, user MSGraphUser) (Identity, error) {
+	identity := Identity{Email: user.Mail}
+	if identity.Email == "" {
+		identity.Email = user.UserPrincipalName
+	}
+
+	claims := idTokenClaims{}
+	if rawIDToken, ok := token.Extra("id_token").(string); ok {
+		// the token comes straight from the token endpoint over TLS,
+		// so its signature does not need to be checked
+		_, _, err := jwt.NewParser().ParseUnverified(rawIDToken, &claims)
+		if err != nil {
+			slog.Error("could not parse ID token", "userID", user.ID, "err", err)
+		}
+	}
+	identity.TenantID = claims.TenantID
+	identity.Groups = claims.Groups
+
+	needsGroups := ah.allowList.needsGroups() || ah.userHandler.MapsGroupsToRoles()
+	if !needsGroups || claims.Groups != nil {
+		return identity, nil
+	}
+
+	groups, err := queryMemberOf(client)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity.Groups = groups
+	return identity, nil
+}
+
+type idTokenClaims struct {
+	TenantID string `json:"tid"`
+	// Groups is nil if the app does not emit the claim
+	// or the user is in too many groups for the token
+	Groups []string `json:"groups"`
+	jwt.RegisteredClaims
+}
+
+// queryMemberOf returns the IDs of all groups the user is a direct member of
+func queryMemberOf(client *http.Client) ([]string, error) {
+	groups := []string{}
+	url := "https://graph.microsoft.com/v1.0/me/memberOf?$select=id"
+	for url != "" {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("memberOf returned status %d", resp.StatusCode)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range page.Value {
+			groups = append(groups, group.ID)
+		}
+		url = page.NextLink
+	}
+	return groups, nil
+}
+
+// failLogin records the failed attempt, there is no user to attribute it to yet
+func (ah *AuthHandler) failLogin(w http.ResponseWriter, r *http.Request, message string, err error) {
+	ah.auditHandler.Record(r, "", audit.LoginFailed, audit.Target{}, message)
+	http.Error(w, message+": "+err.Error(), http.StatusInternalServerError)
+}
+
+func (ah *AuthHandler) makeCookieOutOfOAuthToken(tokenString string, expiry time.Time) http.Cookie {
 	cookie := http.Cookie{}
 	cookie.Name = "token"
 	cookie.Value = tokenString
 	cookie.Expires = expiry
-	cookie.Secure = false // TODO: Set to true if using HTTPS
+	cookie.Secure = ah.cookies.Secure
+	cookie.SameSite = ah.cookies.SameSite
 	cookie.HttpOnly = true
 	cookie.Path = "/"
 
@@ -90,3 +215,28 @@ type MSGraphUser struct {
 	UserPrincipalName string   `json:"userPrincipalName"`
 	ID                string   `json:"id"`
 }
+
+// profile falls back to the principal name
+// for users without a display name
+func (u MSGraphUser) profile() user.Profile {
+	name := u.DisplayName
+	if name == "" {
+		name = u.UserPrincipalName
+	}
+	return user.Profile{
+		ID:             u.ID,
+		Name:           name,
+		Email:          u.Mail,
+		GivenName:      u.GivenName,
+		Surname:        u.Surname,
+		JobTitle:       stringOrEmpty(u.JobTitle),
+		OfficeLocation: stringOrEmpty(u.OfficeLocation),
+	}
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -1,10 +1,11 @@
 package auth
 
 import (
-	"agora/src/log"
 	"agora/src/user"
 	"context"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
 const loginURL = "/login"
@@ -16,9 +17,10 @@ func (ah *AuthHandler) Middleware(next http.Handler) http.Handler {
 		cookieFound := err == nil && cookie.Value != ""
 
 		tryingToLogin := r.URL.Path == loginURL || r.URL.Path == callbackURL
+		cookieOptional := tryingToLogin || ah.allowedWithoutCookie(r.URL.Path)
 
 		if !cookieFound {
-			if tryingToLogin {
+			if cookieOptional {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -29,18 +31,48 @@ func (ah *AuthHandler) Middleware(next http.Handler) http.Handler {
 
 		token, err := ah.VerifyToken(cookie.Value)
 		if err != nil {
-			if tryingToLogin {
+			if cookieOptional {
 				next.ServeHTTP(w, r)
 				return
 			}
-			log.Error.Printf("Invalid token: %v, redirecting to login\n", err)
+			slog.WarnContext(r.Context(), "invalid token, redirecting to login", "err", err)
 			http.Redirect(w, r, loginURL, http.StatusFound)
 			return
 		}
 
 		claims, ok := token.Claims.(*CustomClaims)
 		if !ok {
-			log.Error.Println("Token claims are not of type CustomClaims, redirecting to login")
+			slog.ErrorContext(r.Context(), "token claims are not of type CustomClaims, redirecting to login")
+			http.Redirect(w, r, loginURL, http.StatusFound)
+			return
+		}
+
+		// checked on every request, so a suspension
+		// does not wait for the token to expire
+		suspension, err := ah.userHandler.QuerySuspension(claims.UserID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not check if user is suspended", "userID", claims.UserID, "err", err)
+			http.Error(w, "Could not check your account, please try again", http.StatusInternalServerError)
+			return
+		}
+		if suspension.Suspended {
+			slog.InfoContext(r.Context(), "rejected request of suspended user", "userID", claims.UserID, "path", r.URL.Path)
+			ah.renderSuspended(w, r, suspension)
+			return
+		}
+
+		revokedAt, err := ah.userHandler.SessionsRevokedAt(claims.UserID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not check if sessions are revoked", "userID", claims.UserID, "err", err)
+			http.Error(w, "Could not check your account, please try again", http.StatusInternalServerError)
+			return
+		}
+		if claims.IssuedAt != nil && claims.IssuedAt.Before(revokedAt) {
+			if cookieOptional {
+				next.ServeHTTP(w, r)
+				return
+			}
+			slog.InfoContext(r.Context(), "rejected revoked session", "userID", claims.UserID, "path", r.URL.Path)
 			http.Redirect(w, r, loginURL, http.StatusFound)
 			return
 		}
@@ -49,6 +81,7 @@ func (ah *AuthHandler) Middleware(next http.Handler) http.Handler {
 			ID:    claims.UserID,
 			Name:  claims.Name,
 			Email: claims.Email,
+			Role:  claims.Role,
 		}
 
 		ctx := context.WithValue(r.Context(), "user", user)
@@ -56,12 +89,29 @@ func (ah *AuthHandler) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// AllowWithoutCookie lets requests below prefix through without a login.
+// Handlers there authenticate on their own, e.g. with a feed token,
+// the user is still in the context if there is a valid cookie.
+func (ah *AuthHandler) AllowWithoutCookie(prefix string) {
+	ah.prefixesWithoutCookie = append(ah.prefixesWithoutCookie, prefix)
+}
+
+func (ah *AuthHandler) allowedWithoutCookie(path string) bool {
+	for _, prefix := range ah.prefixesWithoutCookie {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (ah *AuthHandler) MockMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := user.User{
 			ID:    "999",
 			Name:  "John Local",
 			Email: "john@localhost.com",
+			Role:  user.RoleAdmin,
 		}
 		if !ah.userHandler.UserExists(user.ID) {
 			ah.userHandler.AddUser(user.ID, "John Local", user.Email)
@@ -74,7 +124,7 @@ func (ah *AuthHandler) MockMiddleware(next http.Handler) http.Handler {
 func ExtractUserFromContext(ctx context.Context) (user.User, bool) {
 	loggedInUser, ok := ctx.Value("user").(user.User)
 	if !ok {
-		log.Error.Println("Could not extract user from context")
+		slog.ErrorContext(ctx, "could not extract user from context")
 		return user.User{}, false
 	}
 	return loggedInUser, true
@@ -1,8 +1,8 @@
 package auth
 
 import (
-	"agora/src/log"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,10 +13,11 @@ type CustomClaims struct {
 	UserID string `json:"userid"`
 	Name   string `json:"name"`
 	Email  string `json:"email"`
+	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
-func (ah *AuthHandler) createJWT(userID string, name string, email string, issuer string) (jwt.Token, string) {
+func (ah *AuthHandler) createJWT(userID string, name string, email string, role string, issuer string) (jwt.Token, string) {
 	// Create claims with RegisteredClaims for proper expiration handling
 	now := time.Now()
 	expirationTime := now.Add(time.Hour * 1)
@@ -25,6 +26,7 @@ func (ah *AuthHandler) createJWT(userID string, name string, email string, issue
 		UserID: userID,
 		Name:   name,
 		Email:  email,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -38,7 +40,7 @@ func (ah *AuthHandler) createJWT(userID string, name string, email string, issue
 	// Sign token
 	tokenString, err := token.SignedString([]byte(ah.jwtSecret))
 	if err != nil {
-		log.Error.Printf("Failed to sign token: %v\n", err)
+		slog.Error("failed to sign token", "err", err)
 		panic(err)
 	}
 
@@ -55,14 +57,14 @@ func (ah *AuthHandler) VerifyToken(tokenString string) (jwt.Token, error) {
 	})
 
 	if err != nil {
-		log.Error.Printf("Invalid token: %v\n", err.Error())
+		slog.Error("invalid token", "err", err)
 		return jwt.Token{}, err
 	}
 
 	if _, ok := token.Claims.(*CustomClaims); ok && token.Valid {
 
 	} else {
-		log.Error.Println("Invalid token claims")
+		slog.Error("invalid token claims")
 	}
 
 	return *token, nil
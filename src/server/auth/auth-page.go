@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"agora/src/log"
+	"agora/src/user"
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// The pages cannot use the layout of the render package,
+// render depends on auth for the user in the context
+
+//go:embed auth-suspended.html
+var suspendedTemplate string
+var suspendedPage = template.Must(template.New("suspended").Parse(suspendedTemplate))
+
+//go:embed auth-denied.html
+var deniedTemplate string
+var deniedPage = template.Must(template.New("denied").Parse(deniedTemplate))
+
+// renderSuspended shows the suspended page and removes the login cookie,
+// so the user is not let back in with it after the suspension ends
+// without logging in again
+func (ah *AuthHandler) renderSuspended(w http.ResponseWriter, r *http.Request, suspension user.Suspension) {
+	cookie := ah.makeCookieOutOfOAuthToken("", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	http.SetCookie(w, &cookie)
+
+	renderPage(w, r, suspendedPage, suspension)
+}
+
+// renderDenied shows the page for users outside of the allow list
+func renderDenied(w http.ResponseWriter, r *http.Request, email string) {
+	renderPage(w, r, deniedPage, struct{ Email string }{email})
+}
+
+// renderPage shows the request ID so users can refer to it
+// when they contact an admin
+func renderPage(w http.ResponseWriter, r *http.Request, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	pageData := struct {
+		Data      any
+		RequestID string
+	}{
+		Data:      data,
+		RequestID: log.RequestID(r.Context()),
+	}
+	if err := page.Execute(w, pageData); err != nil {
+		slog.ErrorContext(r.Context(), "could not render page", "page", page.Name(), "err", err)
+	}
+}
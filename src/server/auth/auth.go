@@ -1,17 +1,24 @@
 package auth
 
 import (
+	"agora/src/audit"
 	"agora/src/user"
+	"net/http"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
 type AuthHandler struct {
-	jwtSecret   string
-	issuer      string
-	oauthConfig *oauth2.Config
-	userHandler *user.UserHandler
+	jwtSecret    string
+	issuer       string
+	oauthConfig  *oauth2.Config
+	userHandler  *user.UserHandler
+	auditHandler *audit.AuditHandler
+	allowList    AllowList
+	cookies      CookieSettings
+
+	prefixesWithoutCookie []string
 }
 
 func NewAuthHandler(
@@ -21,7 +28,10 @@ func NewAuthHandler(
 	azureClientID,
 	azureClientSecret string,
 	redirectURL string,
+	allowList AllowList,
+	cookies CookieSettings,
 	userHandler *user.UserHandler,
+	auditHandler *audit.AuditHandler,
 ) *AuthHandler {
 	return &AuthHandler{
 		// I add a timestampt to make sure users are re-logged in every time
@@ -32,18 +42,29 @@ func NewAuthHandler(
 		// this makes sure that does not happen
 		jwtSecret: jwtSecret + time.Now().Format("20060102150405"),
 		// jwtSecret:   jwtSecret,
-		issuer:      issuer,
-		oauthConfig: generateOAuth2Config(azureClientID, azureClientSecret, azureTenantID, redirectURL),
-		userHandler: userHandler,
+		issuer:       issuer,
+		oauthConfig:  generateOAuth2Config(azureClientID, azureClientSecret, azureTenantID, redirectURL),
+		userHandler:  userHandler,
+		auditHandler: auditHandler,
+		allowList:    allowList,
+		cookies:      cookies,
 	}
 }
 
+// CookieSettings apply to the login cookie, Secure should be set
+// whenever Agora is served over HTTPS
+type CookieSettings struct {
+	Secure   bool
+	SameSite http.SameSite
+}
+
 func generateOAuth2Config(clientID, clientSecret, tenantID string, redirectURL string) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL, //  in my case RedirectURL:  "http://localhost:8080/callback"
-		Scopes:       []string{"User.Read"},
+		// openid adds the ID token with the tenant and group claims
+		Scopes: []string{"openid", "User.Read"},
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  "https://login.microsoftonline.com/" + tenantID + "/oauth2/v2.0/authorize",
 			TokenURL: "https://login.microsoftonline.com/" + tenantID + "/oauth2/v2.0/token",
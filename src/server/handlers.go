@@ -0,0 +1,192 @@
+package server
+
+import (
+	"agora/src/admin"
+	"agora/src/audit"
+	"agora/src/chat"
+	"agora/src/config"
+	"agora/src/db"
+	"agora/src/event"
+	"agora/src/feed"
+	"agora/src/health"
+	"agora/src/mail"
+	"agora/src/notification"
+	"agora/src/post"
+	"agora/src/post/bookmark"
+	"agora/src/post/comment"
+	"agora/src/post/poll"
+	"agora/src/post/tag"
+	"agora/src/scim"
+	"agora/src/server/auth"
+	"agora/src/user"
+	"agora/src/user/profile"
+	"agora/src/vote"
+	"agora/src/webhook"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handlers are all services of Agora wired together,
+// building them does not start any background work
+type handlers struct {
+	user         *user.UserHandler
+	audit        *audit.AuditHandler
+	auth         *auth.AuthHandler
+	notification *notification.NotificationHandler
+	comment      *comment.CommentHandler
+	tag          *tag.TagHandler
+	bookmark     *bookmark.BookmarkHandler
+	poll         *poll.PollHandler
+	post         *post.PostHandler
+	vote         *vote.VoteHandler
+	profile      *profile.ProfileHandler
+	mail         *mail.MailHandler
+	chat         *chat.ChatHandler
+	feed         *feed.FeedHandler
+	webhook      *webhook.WebhookHandler
+	admin        *admin.AdminHandler
+	scim         *scim.ScimHandler
+	health       *health.HealthHandler
+}
+
+func newHandlers(cfg config.Config, db *db.DB) *handlers {
+	h := &handlers{}
+	baseURL := baseURL(cfg)
+
+	h.user = user.NewUserHandler(db, cfg.AdminEmails, cfg.ModeratorEmails, cfg.AdminGroups, cfg.ModeratorGroups)
+	h.audit = audit.NewAuditHandler(db)
+
+	// TODO: too many arguments, refactor
+	h.auth = auth.NewAuthHandler(
+		cfg.JWTSecret,
+		fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		cfg.AzureTenantID,
+		cfg.AzureClientID,
+		cfg.AzureClientSecret,
+		cfg.AzureRedirectURL,
+		auth.AllowList{
+			EmailDomains: cfg.AllowedEmailDomains,
+			TenantIDs:    cfg.AllowedTenantIDs,
+			Groups:       cfg.AllowedGroups,
+		},
+		cookieSettings(cfg),
+		h.user,
+		h.audit,
+	)
+
+	bus := event.NewBus()
+
+	h.notification = notification.NewNotificationHandler(db, bus)
+	h.comment = comment.NewCommentHandler(db, bus)
+	h.tag = tag.NewTagHandler(db, h.audit)
+	h.bookmark = bookmark.NewBookmarkHandler(db)
+	h.poll = poll.NewPollHandler(db)
+	h.post = post.NewPostHandler(db, h.comment, h.tag, h.bookmark, h.poll, h.audit, bus, cfg.RepostAfterDays)
+	h.vote = vote.NewVoteHandler(db, h.post, bus)
+	h.profile = profile.NewProfileHandler(db)
+	h.mail = mail.NewMailHandler(db, mailConfig(cfg), h.post, bus)
+	h.chat = chat.NewChatHandler(db, chatConfig(cfg), h.post, bus)
+
+	h.feed = feed.NewFeedHandler(db, h.post, h.comment, h.audit, baseURL)
+	h.auth.AllowWithoutCookie("/feeds/")
+
+	h.webhook = webhook.NewWebhookHandler(db, h.audit, baseURL, bus)
+	h.admin = admin.NewAdminHandler(db, h.user, h.audit)
+
+	// SCIM is only served with a secret, without one anybody could provision users
+	h.scim = scim.NewScimHandler(db, h.user, h.audit, cfg.ScimSecret, baseURL)
+	if cfg.ScimSecret != "" {
+		h.auth.AllowWithoutCookie("/scim/")
+	}
+
+	// probes of the deployment cannot log in
+	h.health = health.NewHealthHandler()
+	h.auth.AllowWithoutCookie("/healthz")
+	h.auth.AllowWithoutCookie("/readyz")
+	h.auth.AllowWithoutCookie("/version")
+
+	// on the app listener /metrics is protected by its token instead of a login
+	if cfg.MetricsAddress == "" && cfg.MetricsToken != "" {
+		h.auth.AllowWithoutCookie("/metrics")
+	}
+
+	return h
+}
+
+// migrate creates missing tables and columns,
+// users come first as most tables refer to them
+func (h *handlers) migrate() error {
+	migrations := []func() error{
+		h.user.CreateDBTable,
+		h.audit.CreateDBTable,
+		h.notification.CreateDBTable,
+		h.comment.CreateDBTable,
+		h.tag.CreateDBTable,
+		h.bookmark.CreateDBTable,
+		h.poll.CreateDBTable,
+		h.post.CreateDBTable,
+		h.vote.CreateDBTable,
+		h.mail.CreateDBTable,
+		h.chat.CreateDBTable,
+		h.feed.CreateDBTable,
+		h.webhook.CreateDBTable,
+		h.scim.CreateDBTable,
+	}
+
+	var problems []error
+	for _, migration := range migrations {
+		if err := migration(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// Migrate brings the schema of the database up to date
+func Migrate(cfg config.Config, db *db.DB) error {
+	return newHandlers(cfg, db).migrate()
+}
+
+// baseURL is used to build absolute links, e.g. in mails and webhook payloads
+func baseURL(cfg config.Config) string {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://%s:%s", cfg.Host, cfg.Port)
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+func cookieSettings(cfg config.Config) auth.CookieSettings {
+	sameSite := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}[cfg.CookieSameSite]
+	return auth.CookieSettings{Secure: cfg.CookieSecure, SameSite: sameSite}
+}
+
+func mailConfig(cfg config.Config) mail.Config {
+	return mail.Config{
+		Host:          cfg.SMTPHost,
+		Port:          cfg.SMTPPort,
+		Username:      cfg.SMTPUsername,
+		Password:      cfg.SMTPPassword,
+		From:          cfg.SMTPFrom,
+		BaseURL:       baseURL(cfg),
+		DigestWeekday: time.Weekday(cfg.DigestWeekday),
+		DigestHour:    cfg.DigestHour,
+	}
+}
+
+func chatConfig(cfg config.Config) chat.Config {
+	return chat.Config{
+		TeamsURLs:   cfg.TeamsWebhookURLs,
+		SlackURLs:   cfg.SlackWebhookURLs,
+		NewPosts:    cfg.ChatNewPosts,
+		SummaryHour: cfg.ChatSummaryHour,
+		BaseURL:     baseURL(cfg),
+	}
+}
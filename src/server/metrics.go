@@ -0,0 +1,87 @@
+package server
+
+import (
+	"agora/src/db"
+	"agora/src/metrics"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	requests = metrics.NewCounter(
+		"agora_http_requests_total",
+		"HTTP requests by route and status code.",
+		"method", "route", "status",
+	)
+	requestDuration = metrics.NewHistogram(
+		"agora_http_request_duration_seconds",
+		"Duration of HTTP requests by route.",
+		metrics.DefaultBuckets,
+		"method", "route",
+	)
+)
+
+// metricsMiddleware counts and times the requests by their route
+// template, e.g. /posts/{id}, so every post does not get its own series
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		requests.Inc(r.Method, route, strconv.Itoa(recorder.status))
+		requestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// registerEntityCounts adds gauges counted on every scrape
+func registerEntityCounts(database *db.DB) {
+	for _, table := range []string{"posts", "comments", "votes", "users"} {
+		query := `SELECT count(*) FROM "` + table + `"`
+		metrics.NewGaugeFunc("agora_"+table, "Number of "+table+".", func() (float64, error) {
+			var count int
+			err := database.QueryRow(query).Scan(&count)
+			if err != nil {
+				slog.Error("could not count for metrics", "table", table, "err", err)
+			}
+			return float64(count), err
+		})
+	}
+}
+
+// startMetrics serves /metrics on the separate listener if there is one,
+// otherwise on the app router if a token protects it
+func (s *Server) startMetrics(router *mux.Router) {
+	handler := metrics.Handler(s.config.MetricsToken)
+
+	if s.config.MetricsAddress != "" {
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", handler)
+		s.metricsServer = &http.Server{Addr: s.config.MetricsAddress, Handler: metricsRouter}
+
+		slog.Info("metrics listening", "address", s.config.MetricsAddress)
+		go func() {
+			if err := s.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("metrics listener failed", "err", err)
+			}
+		}()
+		return
+	}
+
+	if s.config.MetricsToken != "" {
+		router.Handle("/metrics", handler).Methods("GET")
+		return
+	}
+
+	slog.Info("metrics are disabled, neither METRICS_ADDRESS nor METRICS_TOKEN is set")
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"agora/src/log"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits IDs passed in by a proxy,
+// anything else ends up in logs and pages unescaped
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestIDMiddleware keeps the request ID of a proxy or creates one,
+// it is added to the context for log records, to the response header
+// and to the plain text error pages written by http.Error
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(log.WithRequestID(r.Context(), requestID)))
+
+		if recorder.status >= http.StatusBadRequest && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+			io.WriteString(w, "Request ID: "+requestID+"\n")
+		}
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// accessLogMiddleware logs every request once it is answered
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case recorder.status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case strings.HasPrefix(r.URL.Path, "/static/"):
+			level = slog.LevelDebug
+		}
+
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration", time.Since(start),
+			"remoteAddr", r.RemoteAddr,
+			"userAgent", r.UserAgent(),
+		)
+	})
+}
+
+// statusRecorder keeps the status code and the size of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
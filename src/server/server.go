@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"errors"
 	"fmt"
@@ -8,45 +9,41 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"agora/src/config"
 	"agora/src/db"
 	"agora/src/log"
-	"agora/src/post"
-	"agora/src/post/comment"
 	"agora/src/ranker"
-	"agora/src/server/auth"
-	"agora/src/user"
-	"agora/src/vote"
+	"log/slog"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 )
 
 // Server provides an http server wrap around services
 type Server struct {
-	host    string
-	port    string
+	config  config.Config
 	stop    chan os.Signal
 	stopped chan struct{}
 	server  *http.Server
-	dbpath  string
+	// metricsServer is nil without a separate metrics listener
+	metricsServer *http.Server
+
+	// set by Start, everything that has to be stopped at shutdown
+	db       *db.DB
+	handlers *handlers
+	ranker   *ranker.Ranker
 }
 
 // NewServer creates a new Server
 // Basic Usage:
-// srv := new Server("0.0.0.0","8080")
+// srv := new Server(cfg)
 // srv.Start()
 // srv.WaitTilRunning()
-func NewServer(
-	host string,
-	port string,
-	dbpath string,
-) (s *Server) {
+func NewServer(cfg config.Config) (s *Server) {
 
 	return &Server{
-		host:    host,
-		port:    port,
-		dbpath:  dbpath,
+		config:  cfg,
 		stop:    make(chan os.Signal, 1),
 		stopped: make(chan struct{}, 1),
 	}
@@ -59,77 +56,157 @@ var staticFiles embed.FS
 // and returns a Stopper function
 func (s *Server) Start() Stopper {
 
-	env := LoadEnv()
-	address := fmt.Sprintf("%s:%s", s.host, s.port)
+	address := fmt.Sprintf("%s:%s", s.config.Host, s.config.Port)
 
-	db, err := db.Open(s.dbpath)
+	database, err := db.Open(s.config.DBPath)
 	if err != nil {
-		log.Error.Fatalf("msg='could not open database' dbpath='%s' err='%s'\n", s.dbpath, err)
+		log.Fatal("could not open database", "dbpath", s.config.DBPath, "err", err)
+	}
+
+	h := newHandlers(s.config, database)
+	migrated := false
+	h.health.AddCheck("database", database.Ping)
+	h.health.AddCheck("migrations", func() error {
+		if !migrated {
+			return errors.New("not applied")
+		}
+		return nil
+	})
+
+	if err := h.migrate(); err != nil {
+		log.Fatal("could not migrate database", "dbpath", s.config.DBPath, "err", err)
 	}
-	userHandler := user.NewUserHandler(db)
-	userHandler.CreateDBTable()
-
-	// TODO: too many arguments, refactor
-	authHandler := auth.NewAuthHandler(
-		env.JWTSecret,
-		address,
-		env.AzureTenantID,
-		env.AzureClientID,
-		env.AzureClientSecret,
-		env.AzureRedirectURL,
-		userHandler,
-	)
-
-	commentHandler := comment.NewCommentHandler(db)
-	commentHandler.CreateDBTable()
-
-	postHandler := post.NewPostHandler(db, commentHandler)
-	postHandler.CreateDBTable()
-
-	voteHandler := vote.NewVoteHandler(db, postHandler)
-	voteHandler.CreateDBTable()
-
-	rnk := ranker.NewRanker(postHandler)
+	migrated = true
+
+	h.mail.Start()
+	h.chat.Start()
+	h.webhook.Start()
+
+	rnk := ranker.NewRanker(h.post)
 	rnk.Start()
+	h.health.AddCheck("ranker", func() error {
+		if !rnk.Running() {
+			return errors.New("not running")
+		}
+		return nil
+	})
+
+	registerEntityCounts(database)
+
+	s.db = database
+	s.handlers = h
+	s.ranker = rnk
 
 	go func() {
 		var router = mux.NewRouter()
 		fs := http.FileServer(http.FS(staticFiles))
 
-		s.server = &http.Server{Addr: address, Handler: router}
+		// outside of the router so unmatched requests are logged as well
+		s.server = &http.Server{Addr: address, Handler: requestIDMiddleware(accessLogMiddleware(router))}
 
 		//
 		// ROUTES
 		//
 		router.StrictSlash(true)
-		// router.Use(loggingMiddleware)
-		router.Use(authHandler.Middleware)
-		// router.Use(authHandler.MockMiddleware)
+		router.Use(metricsMiddleware)
+		router.Use(h.auth.Middleware)
+		router.Use(h.auth.CSRFMiddleware)
+		router.Use(h.notification.Middleware)
+		// router.Use(h.auth.MockMiddleware)
 		router.PathPrefix("/static/").Handler(fs)
 
-		router.HandleFunc("/", postHandler.PostListHandler).Methods("GET")
-		router.HandleFunc("/", postHandler.PostListHandler).Methods("GET")
-
-		router.HandleFunc("/login", authHandler.HandleLogin).Methods("GET")
-		router.HandleFunc("/login/callback", authHandler.HandleLoginCallback).Methods("GET")
-
-		router.HandleFunc("/posts/", postHandler.PostListHandler).Methods("GET")
-		router.HandleFunc("/posts/submit", postHandler.PostSubmitGETHandler).Methods("GET")
-		router.HandleFunc("/posts/submit", postHandler.PostSubmitPOSTHandler).Methods("POST")
-		router.HandleFunc("/posts/{id}", postHandler.PostDetailGETHandler).Methods("GET")
-		router.HandleFunc("/posts/{id}/delete", postHandler.PostDetailDELETEHandler).Methods("POST")
-		router.HandleFunc("/posts/{id}/comment", postHandler.PostCommentPOSTHandler).Methods("POST")
-
-		router.HandleFunc("/vote", voteHandler.VotePOSTHandler).Methods("POST")
-
-		log.Info.Printf("state=http_listening address=%s", s.Address())
+		router.HandleFunc("/", h.post.PostListHandler).Methods("GET")
+		router.HandleFunc("/", h.post.PostListHandler).Methods("GET")
+
+		router.HandleFunc("/healthz", h.health.HealthzGETHandler).Methods("GET")
+		router.HandleFunc("/readyz", h.health.ReadyzGETHandler).Methods("GET")
+		router.HandleFunc("/version", h.health.VersionGETHandler).Methods("GET")
+
+		router.HandleFunc("/login", h.auth.HandleLogin).Methods("GET")
+		router.HandleFunc("/login/callback", h.auth.HandleLoginCallback).Methods("GET")
+
+		router.HandleFunc("/posts/", h.post.PostListHandler).Methods("GET")
+		router.HandleFunc("/posts/submit", h.post.PostSubmitGETHandler).Methods("GET")
+		router.HandleFunc("/posts/submit", h.post.PostSubmitPOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}", h.post.PostDetailGETHandler).Methods("GET")
+		router.HandleFunc("/posts/{id}/delete", h.post.PostDetailDELETEHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/comment", h.post.PostCommentPOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/pin", h.post.PostPinPOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/lock", h.post.PostLockPOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/poll", h.poll.PollVotePOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/bookmark", h.bookmark.BookmarkTogglePOSTHandler).Methods("POST")
+		router.HandleFunc("/posts/{id}/bookmark/note", h.bookmark.BookmarkNotePOSTHandler).Methods("POST")
+
+		router.HandleFunc("/saved", h.post.SavedPostsHandler).Methods("GET")
+		router.HandleFunc("/ask", h.post.AskPostsHandler).Methods("GET")
+		router.HandleFunc("/show", h.post.ShowPostsHandler).Methods("GET")
+
+		router.HandleFunc("/tags/", h.tag.TagIndexGETHandler).Methods("GET")
+		router.HandleFunc("/tags/{tag}", h.post.TagFeedHandler).Methods("GET")
+		router.HandleFunc("/tags/{tag}/rename", h.tag.TagRenamePOSTHandler).Methods("POST")
+		router.HandleFunc("/tags/{tag}/merge", h.tag.TagMergePOSTHandler).Methods("POST")
+
+		router.HandleFunc("/users/{id}", h.profile.ProfileGETHandler).Methods("GET")
+
+		router.HandleFunc("/settings/email", h.mail.MailSettingsGETHandler).Methods("GET")
+		router.HandleFunc("/settings/email", h.mail.MailSettingsPOSTHandler).Methods("POST")
+
+		router.HandleFunc("/settings/feeds", h.feed.FeedSettingsGETHandler).Methods("GET")
+		router.HandleFunc("/settings/feeds/token", h.feed.FeedTokenPOSTHandler).Methods("POST")
+
+		router.HandleFunc("/feeds/top.{format:atom|rss}", h.feed.TopFeedGETHandler).Methods("GET")
+		router.HandleFunc("/feeds/new.{format:atom|rss}", h.feed.NewFeedGETHandler).Methods("GET")
+		router.HandleFunc("/feeds/tags/{tag}.{format:atom|rss}", h.feed.TagFeedGETHandler).Methods("GET")
+		router.HandleFunc("/feeds/posts/{id}/comments.{format:atom|rss}", h.feed.CommentFeedGETHandler).Methods("GET")
+
+		router.HandleFunc("/notifications", h.notification.NotificationListGETHandler).Methods("GET")
+		router.HandleFunc("/notifications/read", h.notification.NotificationReadAllPOSTHandler).Methods("POST")
+		router.HandleFunc("/notifications/{id}/read", h.notification.NotificationReadPOSTHandler).Methods("POST")
+
+		router.HandleFunc("/vote", h.vote.VotePOSTHandler).Methods("POST")
+
+		router.HandleFunc("/admin", h.admin.DashboardGETHandler).Methods("GET")
+		router.HandleFunc("/admin/users", h.admin.UsersGETHandler).Methods("GET")
+		router.HandleFunc("/admin/users/{id}/disable", h.admin.UserDisablePOSTHandler).Methods("POST")
+		router.HandleFunc("/admin/users/{id}/delete-content", h.admin.UserDeleteContentPOSTHandler).Methods("POST")
+		router.HandleFunc("/admin/audit", h.admin.AuditLogGETHandler).Methods("GET")
+		router.HandleFunc("/admin/audit.csv", h.admin.AuditLogCSVHandler).Methods("GET")
+
+		router.HandleFunc("/admin/webhooks", h.webhook.WebhookListGETHandler).Methods("GET")
+		router.HandleFunc("/admin/webhooks", h.webhook.WebhookCreatePOSTHandler).Methods("POST")
+		router.HandleFunc("/admin/webhooks/{id}/toggle", h.webhook.WebhookTogglePOSTHandler).Methods("POST")
+		router.HandleFunc("/admin/webhooks/{id}/delete", h.webhook.WebhookDeletePOSTHandler).Methods("POST")
+		router.HandleFunc("/admin/webhooks/{id}/deliveries", h.webhook.WebhookDeliveriesGETHandler).Methods("GET")
+		router.HandleFunc("/admin/webhooks/{id}/deliveries/{delivery}/retry", h.webhook.WebhookRetryPOSTHandler).Methods("POST")
+
+		if s.config.ScimSecret != "" {
+			scimRouter := router.PathPrefix("/scim/v2").Subrouter()
+			scimRouter.Use(h.scim.Middleware)
+			scimRouter.HandleFunc("/ServiceProviderConfig", h.scim.ServiceProviderConfigGETHandler).Methods("GET")
+			scimRouter.HandleFunc("/Users", h.scim.UsersGETHandler).Methods("GET")
+			scimRouter.HandleFunc("/Users", h.scim.UserPOSTHandler).Methods("POST")
+			scimRouter.HandleFunc("/Users/{id}", h.scim.UserGETHandler).Methods("GET")
+			scimRouter.HandleFunc("/Users/{id}", h.scim.UserPUTHandler).Methods("PUT")
+			scimRouter.HandleFunc("/Users/{id}", h.scim.UserPATCHHandler).Methods("PATCH")
+			scimRouter.HandleFunc("/Users/{id}", h.scim.UserDELETEHandler).Methods("DELETE")
+			scimRouter.HandleFunc("/Groups", h.scim.GroupsGETHandler).Methods("GET")
+			scimRouter.HandleFunc("/Groups", h.scim.GroupPOSTHandler).Methods("POST")
+			scimRouter.HandleFunc("/Groups/{id}", h.scim.GroupGETHandler).Methods("GET")
+			scimRouter.HandleFunc("/Groups/{id}", h.scim.GroupPUTHandler).Methods("PUT")
+			scimRouter.HandleFunc("/Groups/{id}", h.scim.GroupPATCHHandler).Methods("PATCH")
+			scimRouter.HandleFunc("/Groups/{id}", h.scim.GroupDELETEHandler).Methods("DELETE")
+		}
+
+		s.startMetrics(router)
+
+		slog.Info("http listening", "address", s.Address())
 		go func() {
 			if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Error.Println(err)
+				slog.Error("http listener failed", "err", err)
 			}
 		}()
 		signal.Notify(s.stop, os.Interrupt, syscall.SIGTERM)
-		s.waitForStop(&s.stop, s.server)
+		s.waitForStop()
 	}()
 
 	return s.Stop
@@ -138,7 +215,7 @@ func (s *Server) Start() Stopper {
 // Stops the server
 // Users can wait until the server is stopped:
 // ```go
-// s := s.NewServer("localhost","8080")
+// s := s.NewServer(cfg)
 // someOtherFunc()
 // stop := s.Start()
 // <-stop()
@@ -147,7 +224,7 @@ type Stopper = func() Stopped
 
 // Address returns the full address of the server
 func (s *Server) Address() string {
-	return fmt.Sprintf("http://%s:%s", s.host, s.port)
+	return fmt.Sprintf("http://%s:%s", s.config.Host, s.config.Port)
 }
 
 // Stop stops the server and returns the Sopped chanel
@@ -159,83 +236,64 @@ func (s *Server) Stop() chan struct{} {
 // Stopped chan receives an empty struct when the server has stopped
 type Stopped = chan struct{}
 
-func (s *Server) waitForStop(stop *chan os.Signal, server *http.Server) {
+func (s *Server) waitForStop() {
 	<-s.stop
-	err := s.server.Close()
-	if err != nil {
-		log.Error.Println(err)
+	slog.Info("shutting down", "timeout", time.Duration(s.config.ShutdownTimeout)*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		slog.Error("shutdown was not clean", "err", err)
 	}
 	s.stopped <- struct{}{}
 }
 
-// WaitTilRunning waits until the server is stopped
-func (s *Server) WaitTilRunning() {
-	<-s.stopped
-}
-
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Debug.Println(r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
-	})
-}
-
-type AzureConfig struct {
-	TenantID     string
-	ClientID     string
-	ClientSecret string
-}
-
-type Env struct {
-	AzureTenantID     string
-	AzureClientID     string
-	AzureClientSecret string
-	AzureRedirectURL  string
-	JWTSecret         string
-}
-
-func LoadEnv() Env {
-	err := godotenv.Load()
-	if err != nil {
-		log.Error.Fatalf("msg='could not load .env file' err='%s'\n", err.Error())
-	}
-
-	env := Env{
-		AzureTenantID:     os.Getenv("AZURE_TENANT_ID"),
-		AzureClientID:     os.Getenv("AZURE_CLIENT_ID"),
-		AzureClientSecret: os.Getenv("AZURE_CLIENT_SECRET"),
-		AzureRedirectURL:  os.Getenv("AZURE_REDIRECT_URL"),
-		JWTSecret:         os.Getenv("JWT_SECRET"),
+// Shutdown stops accepting connections and waits for running requests
+// until the context is done, then stops the background workers
+// and closes the database. Each phase is logged.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var problems []error
+
+	slog.Info("draining requests")
+	if err := s.server.Shutdown(ctx); err != nil {
+		slog.WarnContext(ctx, "requests did not finish in time, closing their connections", "err", err)
+		problems = append(problems, err)
+		if err := s.server.Close(); err != nil {
+			problems = append(problems, err)
+		}
 	}
 
-	return env
-}
-
-func LoadAzureConfig() (AzureConfig, error) {
-
-	err := godotenv.Load()
-	if err != nil {
-		log.Error.Fatalf("msg='could not load .env file' err='%s'\n", err.Error())
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Shutdown(ctx); err != nil {
+			problems = append(problems, err)
+		}
 	}
 
-	tenantID := os.Getenv("AZURE_TENANT_ID")
-	if tenantID == "" {
-		return AzureConfig{}, errors.New("missing AZURE_TENANT_ID environment variable")
+	// the workers finish the item they are sending,
+	// the rest of their queues stays in the database
+	slog.Info("stopping workers")
+	s.ranker.Stop()
+	s.handlers.mail.Stop()
+	s.handlers.chat.Stop()
+	s.handlers.webhook.Stop()
+
+	slog.Info("checkpointing database")
+	if err := s.db.Checkpoint(); err != nil {
+		slog.ErrorContext(ctx, "could not checkpoint database", "err", err)
+		problems = append(problems, err)
 	}
 
-	clientID := os.Getenv("AZURE_CLIENT_ID")
-	if clientID == "" {
-		return AzureConfig{}, errors.New("missing AZURE_CLIENT_ID environment variable")
+	slog.Info("closing database")
+	if err := s.db.Close(); err != nil {
+		slog.ErrorContext(ctx, "could not close database", "err", err)
+		problems = append(problems, err)
 	}
 
-	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
-	if clientSecret == "" {
-		return AzureConfig{}, errors.New("missing AZURE_CLIENT_SECRET environment variable")
-	}
+	slog.Info("stopped")
+	return errors.Join(problems...)
+}
 
-	return AzureConfig{
-		TenantID:     tenantID,
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-	}, nil
+// WaitTilRunning waits until the server is stopped
+func (s *Server) WaitTilRunning() {
+	<-s.stopped
 }
@@ -0,0 +1,159 @@
+package profile
+
+import (
+	"database/sql"
+	"log/slog"
+)
+
+// queryProfile returns the user with their karma,
+// the number of votes other users gave to their posts and comments
+func (ph *ProfileHandler) queryProfile(userID string) (Profile, error) {
+	var profile Profile
+	err := ph.db.QueryRow(`
+		SELECT
+			u.id, u.name, u.job_title, u.office_location, u.created_at,
+			(SELECT count(*) FROM votes v
+				JOIN posts p ON p.id = v.fk_post_id
+				WHERE p.fk_user_id = u.id AND v.fk_user_id != u.id)
+			+
+			(SELECT count(*) FROM votes v
+				JOIN comments c ON c.id = v.fk_comment_id
+				WHERE c.fk_user_id = u.id AND v.fk_user_id != u.id) karma
+		FROM users u
+		WHERE u.id = ?`,
+		userID,
+	).Scan(
+		&profile.ID,
+		&profile.Name,
+		&profile.JobTitle,
+		&profile.OfficeLocation,
+		&profile.CreatedAt,
+		&profile.Karma,
+	)
+	if err == sql.ErrNoRows {
+		return NullProfile, nil
+	}
+	if err != nil {
+		slog.Error("could not query profile", "userID", userID, "err", err)
+		return NullProfile, err
+	}
+
+	return profile, nil
+}
+
+// queryFormerNames keeps renamed users recognizable,
+// the most recent name first
+func (ph *ProfileHandler) queryFormerNames(userID string) ([]string, error) {
+	rows, err := ph.db.Query(`
+		SELECT old_value
+		FROM user_profile_history
+		WHERE fk_user_id = ? AND field = 'name'
+		GROUP BY old_value
+		ORDER BY max(id) DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			slog.Error("could not scan former name of user", "userID", userID, "err", err)
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (ph *ProfileHandler) queryPostsOfUser(userID string) ([]ProfilePostRecord, error) {
+	rows, err := ph.db.Query(`
+		SELECT
+			p.id, p.title, p.url, p.created_at,
+			(SELECT count(*) FROM comments c WHERE c.fk_post_id = p.id) nr_comments,
+			(SELECT count(*) FROM votes v WHERE v.fk_post_id = p.id) nr_votes
+		FROM posts p
+		WHERE p.fk_user_id = ?
+		ORDER BY p.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ProfilePostRecord
+	for rows.Next() {
+		var record ProfilePostRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.Title,
+			&record.URL,
+			&record.CreatedAt,
+			&record.FNrOfComments,
+			&record.FNrOfVotes,
+		)
+		if err != nil {
+			slog.Error("could not scan post of user", "userID", userID, "err", err)
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+type ProfilePostRecord struct {
+	ID            int
+	Title         string
+	URL           sql.NullString
+	CreatedAt     string
+	FNrOfComments int
+	FNrOfVotes    int
+}
+
+func (ph *ProfileHandler) queryCommentsOfUser(userID string) ([]ProfileCommentRecord, error) {
+	rows, err := ph.db.Query(`
+		SELECT c.id, c.text, c.created_at, c.fk_post_id, p.title
+		FROM comments c
+		JOIN posts p ON p.id = c.fk_post_id
+		WHERE c.fk_user_id = ?
+		ORDER BY c.created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ProfileCommentRecord
+	for rows.Next() {
+		var record ProfileCommentRecord
+		err := rows.Scan(
+			&record.ID,
+			&record.Text,
+			&record.CreatedAt,
+			&record.PostID,
+			&record.FPostTitle,
+		)
+		if err != nil {
+			slog.Error("could not scan comment of user", "userID", userID, "err", err)
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+type ProfileCommentRecord struct {
+	ID         int
+	Text       string
+	CreatedAt  string
+	PostID     int
+	FPostTitle string
+}
@@ -0,0 +1,13 @@
+package profile
+
+import (
+	"agora/src/db"
+)
+
+type ProfileHandler struct {
+	db *db.DB
+}
+
+func NewProfileHandler(db *db.DB) *ProfileHandler {
+	return &ProfileHandler{db: db}
+}
@@ -0,0 +1,115 @@
+package profile
+
+import (
+	"agora/src/render"
+	"agora/src/x/date"
+	_ "embed"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed profile.html
+var profileTemplate string
+
+func (ph *ProfileHandler) ProfileGETHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	profile, err := ph.queryProfile(userID)
+	if err != nil {
+		http.Error(w, "Could not retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	if profile == NullProfile {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	postRecords, err := ph.queryPostsOfUser(userID)
+	if err != nil {
+		http.Error(w, "Could not retrieve posts of user", http.StatusInternalServerError)
+		return
+	}
+
+	formerNames, err := ph.queryFormerNames(userID)
+	if err != nil {
+		http.Error(w, "Could not retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	commentRecords, err := ph.queryCommentsOfUser(userID)
+	if err != nil {
+		http.Error(w, "Could not retrieve comments of user", http.StatusInternalServerError)
+		return
+	}
+
+	var posts []ProfilePostItem
+	for _, record := range postRecords {
+		posts = append(posts, ProfilePostItem{
+			ID:               record.ID,
+			Title:            record.Title,
+			URL:              record.URL.String,
+			CreatedAt:        date.FormatDate(record.CreatedAt),
+			NumberOfComments: record.FNrOfComments,
+			NumberOfVotes:    record.FNrOfVotes,
+		})
+	}
+
+	var comments []ProfileCommentItem
+	for _, record := range commentRecords {
+		comments = append(comments, ProfileCommentItem{
+			ID:        record.ID,
+			Text:      record.Text,
+			CreatedAt: date.FormatDate(record.CreatedAt),
+			PostID:    record.PostID,
+			PostTitle: record.FPostTitle,
+		})
+	}
+
+	render.RenderTemplate(
+		w,
+		"profile.html",
+		&render.Page{
+			Title: profile.Name,
+			Data: struct {
+				Name           string
+				FormerNames    []string
+				JobTitle       string
+				OfficeLocation string
+				JoinedAt       string
+				Karma          int
+				Posts          []ProfilePostItem
+				Comments       []ProfileCommentItem
+			}{
+				Name:           profile.Name,
+				FormerNames:    formerNames,
+				JobTitle:       profile.JobTitle,
+				OfficeLocation: profile.OfficeLocation,
+				JoinedAt:       date.FormatDate(profile.CreatedAt),
+				Karma:          profile.Karma,
+				Posts:          posts,
+				Comments:       comments,
+			},
+		},
+		r.Context(),
+		profileTemplate,
+	)
+}
+
+type ProfilePostItem struct {
+	ID               int
+	Title            string
+	URL              string
+	CreatedAt        string
+	NumberOfComments int
+	NumberOfVotes    int
+}
+
+type ProfileCommentItem struct {
+	ID        int
+	Text      string
+	CreatedAt string
+	PostID    int
+	PostTitle string
+}
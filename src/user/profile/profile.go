@@ -0,0 +1,12 @@
+package profile
+
+type Profile struct {
+	ID             string
+	Name           string
+	JobTitle       string
+	OfficeLocation string
+	CreatedAt      string
+	Karma          int
+}
+
+var NullProfile = Profile{}
@@ -1,23 +1,85 @@
 package user
 
 import (
-	"agora/src/log"
+	"agora/src/x/date"
 	"database/sql"
 	"errors"
+	"log/slog"
+	"time"
 )
 
 const TABLE_QUERY = `CREATE TABLE IF NOT EXISTS users (
 		id TEXT PRIMARY KEY,
 		name TEXT NOT NULL,
 		email TEXT UNIQUE NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		role TEXT NOT NULL DEFAULT 'user',
+		last_login_at DATETIME,
+		disabled_at DATETIME,
+		disabled_until DATETIME,
+		given_name TEXT NOT NULL DEFAULT '',
+		surname TEXT NOT NULL DEFAULT '',
+		job_title TEXT NOT NULL DEFAULT '',
+		office_location TEXT NOT NULL DEFAULT '',
+		sessions_revoked_at DATETIME
 		);
 		`
 
+const HISTORY_TABLE_QUERY = `CREATE TABLE IF NOT EXISTS user_profile_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fk_user_id TEXT NOT NULL,
+		field TEXT NOT NULL,
+		old_value TEXT NOT NULL,
+		new_value TEXT NOT NULL,
+		changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (fk_user_id) REFERENCES users(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_profile_history_user ON user_profile_history(fk_user_id, changed_at);
+		`
+
+var ErrUserNotFound = errors.New("user not found")
+
 func (uh *UserHandler) CreateDBTable() error {
 	_, err := uh.db.Exec(TABLE_QUERY)
 	if err != nil {
-		log.Error.Printf("Error creating posts table: %v", err)
+		slog.Error("error creating users table", "err", err)
+		return err
+	}
+
+	if err := uh.db.AddColumnIfMissing("users", "role", "TEXT NOT NULL DEFAULT 'user'"); err != nil {
+		slog.Error("error adding role column to users table", "err", err)
+		return err
+	}
+
+	if err := uh.db.AddColumnIfMissing("users", "last_login_at", "DATETIME"); err != nil {
+		slog.Error("error adding last_login_at column to users table", "err", err)
+		return err
+	}
+
+	if err := uh.db.AddColumnIfMissing("users", "disabled_at", "DATETIME"); err != nil {
+		slog.Error("error adding disabled_at column to users table", "err", err)
+		return err
+	}
+
+	if err := uh.db.AddColumnIfMissing("users", "disabled_until", "DATETIME"); err != nil {
+		slog.Error("error adding disabled_until column to users table", "err", err)
+		return err
+	}
+
+	for _, column := range []string{"given_name", "surname", "job_title", "office_location"} {
+		if err := uh.db.AddColumnIfMissing("users", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+			slog.Error("error adding column to users table", "column", column, "err", err)
+			return err
+		}
+	}
+
+	if err := uh.db.AddColumnIfMissing("users", "sessions_revoked_at", "DATETIME"); err != nil {
+		slog.Error("error adding sessions_revoked_at column to users table", "err", err)
+		return err
+	}
+
+	if _, err := uh.db.Exec(HISTORY_TABLE_QUERY); err != nil {
+		slog.Error("error creating user_profile_history table", "err", err)
 		return err
 	}
 	return nil
@@ -26,7 +88,7 @@ func (uh *UserHandler) CreateDBTable() error {
 // InsertNewUser inserts a new user into the database
 func (uh *UserHandler) insertNewUser(u User) (int64, error) {
 	// Insert a new user into the database
-	result, err := uh.db.Exec("INSERT INTO users (id, name, email) VALUES (?, ?, ?)", u.ID, u.Name, u.Email)
+	result, err := uh.db.Exec("INSERT INTO users (id, name, email, role) VALUES (?, ?, ?, ?)", u.ID, u.Name, u.Email, u.Role)
 	if err != nil {
 		return 0, err
 	}
@@ -35,7 +97,7 @@ func (uh *UserHandler) insertNewUser(u User) (int64, error) {
 
 // QueryOneUser queries a user by ID
 func (uh *UserHandler) queryOneUser(id string) (User, error) {
-	rows, err := uh.db.Query("SELECT id, name, email FROM users WHERE id = ?", id)
+	rows, err := uh.db.Query("SELECT id, name, email, role FROM users WHERE id = ?", id)
 	if err != nil {
 		return User{}, err
 	}
@@ -45,21 +107,21 @@ func (uh *UserHandler) queryOneUser(id string) (User, error) {
 	for rows.Next() {
 		wantedUser, err = scanToUser(rows)
 		if err != nil {
-			log.Error.Printf("Error scanning user with id=%s: %v", id, err)
+			slog.Error("error scanning user", "id", id, "err", err)
 			return NullUser, err
 		}
 
 		if wantedUser.ID == "" {
-			return NullUser, errors.New("user not found")
+			return NullUser, ErrUserNotFound
 		}
 		return wantedUser, nil
 	}
 
-	return NullUser, errors.New("user not found")
+	return NullUser, ErrUserNotFound
 }
 
 func (uh *UserHandler) queryAllUsers() ([]User, error) {
-	rows, err := uh.db.Query("SELECT id, name, email FROM users")
+	rows, err := uh.db.Query("SELECT id, name, email, role FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +131,7 @@ func (uh *UserHandler) queryAllUsers() ([]User, error) {
 	for rows.Next() {
 		user, err := scanToUser(rows)
 		if err != nil {
-			log.Error.Printf("Error scanning user: %v", err)
+			slog.Error("error scanning user", "err", err)
 			return nil, err
 		}
 		users = append(users, user)
@@ -86,12 +148,236 @@ func scanToUser(rows *sql.Rows) (User, error) {
 	var id string
 	var name string
 	var email string
-	if err := rows.Scan(&id, &name, &email); err != nil {
+	var role string
+	if err := rows.Scan(&id, &name, &email, &role); err != nil {
 		return NullUser, err
 	}
 	return User{
 		ID:    id,
 		Name:  name,
 		Email: email,
+		Role:  role,
 	}, nil
 }
+
+// QueryUserByEmail ignores the case of the email
+func (uh *UserHandler) QueryUserByEmail(email string) (User, error) {
+	var u User
+	err := uh.db.QueryRow(
+		"SELECT id, name, email, role FROM users WHERE email = ? COLLATE NOCASE",
+		email,
+	).Scan(&u.ID, &u.Name, &u.Email, &u.Role)
+	if err == sql.ErrNoRows {
+		return NullUser, ErrUserNotFound
+	}
+	return u, err
+}
+
+func (uh *UserHandler) updateRole(id string, role string) error {
+	_, err := uh.db.Exec("UPDATE users SET role = ? WHERE id = ?", role, id)
+	return err
+}
+
+func (uh *UserHandler) RecordLogin(id string) error {
+	_, err := uh.db.Exec("UPDATE users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return err
+}
+
+// SuspendedColumn is true for suspended users of the users table aliased u,
+// for queries of other packages that join users
+const SuspendedColumn = `(u.disabled_at IS NOT NULL AND (u.disabled_until IS NULL OR u.disabled_until > CURRENT_TIMESTAMP))`
+
+// Suspend locks the user out until the given time,
+// the zero time suspends until Unsuspend is called
+func (uh *UserHandler) Suspend(id string, until time.Time) error {
+	disabledUntil := sql.NullString{}
+	if !until.IsZero() {
+		disabledUntil = sql.NullString{String: until.UTC().Format(date.SQLite), Valid: true}
+	}
+
+	return uh.updateSuspension(
+		`UPDATE users SET disabled_at = CURRENT_TIMESTAMP, disabled_until = ? WHERE id = ?`,
+		disabledUntil,
+		id,
+	)
+}
+
+func (uh *UserHandler) Unsuspend(id string) error {
+	return uh.updateSuspension(
+		`UPDATE users SET disabled_at = NULL, disabled_until = NULL WHERE id = ?`,
+		id,
+	)
+}
+
+// RevokeSessions logs the user out everywhere,
+// tokens issued before now are not accepted anymore
+func (uh *UserHandler) RevokeSessions(id string) error {
+	return uh.updateSuspension(
+		`UPDATE users SET sessions_revoked_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		id,
+	)
+}
+
+// SessionsRevokedAt is the zero time if the sessions were never revoked
+func (uh *UserHandler) SessionsRevokedAt(id string) (time.Time, error) {
+	var revokedAt sql.NullTime
+	err := uh.db.QueryRow("SELECT sessions_revoked_at FROM users WHERE id = ?", id).Scan(&revokedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return revokedAt.Time, err
+}
+
+func (uh *UserHandler) updateSuspension(query string, args ...any) error {
+	result, err := uh.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// QuerySuspension is not suspended for unknown users,
+// they cannot have been suspended
+func (uh *UserHandler) QuerySuspension(id string) (Suspension, error) {
+	var suspension Suspension
+	var until sql.NullTime
+	err := uh.db.QueryRow(
+		`SELECT `+SuspendedColumn+`, u.disabled_until FROM users u WHERE u.id = ?`,
+		id,
+	).Scan(&suspension.Suspended, &until)
+	if err == sql.ErrNoRows {
+		return Suspension{}, nil
+	}
+	if err != nil {
+		return Suspension{}, err
+	}
+
+	if suspension.Suspended && until.Valid {
+		suspension.Until = until.Time
+	}
+	return suspension, nil
+}
+
+// profileColumns are read by scanToProfile in this order
+const profileColumns = `id, name, email, given_name, surname, job_title, office_location`
+
+func scanToProfile(row interface{ Scan(...any) error }) (Profile, error) {
+	var p Profile
+	err := row.Scan(&p.ID, &p.Name, &p.Email, &p.GivenName, &p.Surname, &p.JobTitle, &p.OfficeLocation)
+	return p, err
+}
+
+func (uh *UserHandler) QueryProfile(id string) (Profile, error) {
+	profile, err := scanToProfile(uh.db.QueryRow(`SELECT `+profileColumns+` FROM users WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return Profile{}, ErrUserNotFound
+	}
+	return profile, err
+}
+
+// QueryProfiles returns all users ordered by creation
+func (uh *UserHandler) QueryProfiles() ([]Profile, error) {
+	rows, err := uh.db.Query(`SELECT ` + profileColumns + ` FROM users ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []Profile
+	for rows.Next() {
+		profile, err := scanToProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+// upsertProfile inserts the user or updates the changed fields,
+// every change is kept in the history.
+// created is true for new users
+func (uh *UserHandler) upsertProfile(p Profile, role string) (created bool, err error) {
+	tx, err := uh.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the identity provider owns the email, if it moved to this user
+	// the stale copy of the other user has to make room for it
+	var stale []string
+	rows, err := tx.Query("SELECT id FROM users WHERE email = ? AND id != ?", p.Email, p.ID)
+	if err != nil {
+		return false, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+	for _, id := range stale {
+		released := id + "@invalid"
+		if _, err := tx.Exec("UPDATE users SET email = ? WHERE id = ?", released, id); err != nil {
+			return false, err
+		}
+		if err := insertHistory(tx, id, "email", p.Email, released); err != nil {
+			return false, err
+		}
+		slog.Info("released email of other user", "userID", p.ID, "otherUserID", id, "email", p.Email)
+	}
+
+	old, err := scanToProfile(tx.QueryRow(`SELECT `+profileColumns+` FROM users WHERE id = ?`, p.ID))
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(
+			`INSERT INTO users (id, name, email, role, given_name, surname, job_title, office_location)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.ID, p.Name, p.Email, role, p.GivenName, p.Surname, p.JobTitle, p.OfficeLocation,
+		)
+		if err != nil {
+			return false, err
+		}
+		return true, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, change := range old.changes(p) {
+		if err := insertHistory(tx, p.ID, change.Field, change.OldValue, change.NewValue); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE users
+		 SET name = ?, email = ?, given_name = ?, surname = ?, job_title = ?, office_location = ?
+		 WHERE id = ?`,
+		p.Name, p.Email, p.GivenName, p.Surname, p.JobTitle, p.OfficeLocation, p.ID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+func insertHistory(tx *sql.Tx, userID, field, oldValue, newValue string) error {
+	_, err := tx.Exec(
+		`INSERT INTO user_profile_history (fk_user_id, field, old_value, new_value)
+		 VALUES (?, ?, ?, ?)`,
+		userID, field, oldValue, newValue,
+	)
+	return err
+}
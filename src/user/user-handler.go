@@ -2,32 +2,89 @@ package user
 
 import (
 	"agora/src/db"
-	"agora/src/log"
+	"errors"
+	"log/slog"
+	"strings"
 )
 
 type UserHandler struct {
 	db *db.DB
+	// configuredRoles maps lower case emails to the role
+	// they get granted at login, e.g. to bootstrap the first admin
+	configuredRoles map[string]string
+	// groupRoles maps lower case Entra group IDs
+	// to the role their members get granted at login
+	groupRoles map[string]string
 }
 
-func NewUserHandler(db *db.DB) *UserHandler {
+func NewUserHandler(
+	db *db.DB,
+	adminEmails []string,
+	moderatorEmails []string,
+	adminGroups []string,
+	moderatorGroups []string,
+) *UserHandler {
 	return &UserHandler{
-		db: db,
+		db:              db,
+		configuredRoles: roleMap(adminEmails, moderatorEmails),
+		groupRoles:      roleMap(adminGroups, moderatorGroups),
 	}
 }
 
+// roleMap keys are lower case,
+// admin wins if a key is in both lists
+func roleMap(admins []string, moderators []string) map[string]string {
+	roles := map[string]string{}
+	for _, key := range moderators {
+		roles[strings.ToLower(key)] = RoleModerator
+	}
+	for _, key := range admins {
+		roles[strings.ToLower(key)] = RoleAdmin
+	}
+	return roles
+}
+
+// MapsGroupsToRoles is true if LoginRole needs the groups of the user
+func (uh *UserHandler) MapsGroupsToRoles() bool {
+	return len(uh.groupRoles) > 0
+}
+
 func (uh *UserHandler) AddUser(id, name, email string) (User, error) {
 	user := User{
 		ID:    id,
 		Name:  name,
 		Email: email,
+		Role:  RoleUser,
+	}
+	if role, ok := uh.configuredRoles[strings.ToLower(email)]; ok {
+		user.Role = role
 	}
 	if _, err := uh.insertNewUser(user); err != nil {
-		log.Error.Printf("Error adding user: %v", err)
+		slog.Error("error adding user", "err", err)
 		return NullUser, err
 	}
 	return user, nil
 }
 
+// SyncProfile adds the user or updates their profile,
+// new users get the role configured for their email
+func (uh *UserHandler) SyncProfile(profile Profile) error {
+	role := RoleUser
+	if configuredRole, ok := uh.configuredRoles[strings.ToLower(profile.Email)]; ok {
+		role = configuredRole
+	}
+
+	created, err := uh.upsertProfile(profile, role)
+	if err != nil {
+		slog.Error("could not sync profile", "userID", profile.ID, "err", err)
+		return err
+	}
+	if created {
+		slog.Info("added user", "userID", profile.ID, "role", role)
+	}
+	return nil
+}
+
 func (uh *UserHandler) UserExists(id string) bool {
 	user, err := uh.queryOneUser(id)
 	if err != nil {
@@ -36,10 +93,50 @@ func (uh *UserHandler) UserExists(id string) bool {
 	return user.ID != ""
 }
 
+// LoginRole returns the role of the user, granting the role
+// configured for their email or one of their groups
+// if it is higher than their current one.
+// granted is true if the role changed.
+func (uh *UserHandler) LoginRole(id string, groups []string) (role string, granted bool, err error) {
+	user, err := uh.queryOneUser(id)
+	if err != nil {
+		return RoleUser, false, err
+	}
+
+	configuredRole := uh.configuredRoles[strings.ToLower(user.Email)]
+	for _, group := range groups {
+		if groupRole := uh.groupRoles[strings.ToLower(group)]; roleRank[groupRole] > roleRank[configuredRole] {
+			configuredRole = groupRole
+		}
+	}
+	if configuredRole == "" || roleRank[configuredRole] <= roleRank[user.Role] {
+		return user.Role, false, nil
+	}
+
+	if err := uh.updateRole(id, configuredRole); err != nil {
+		slog.Error("could not update role", "userID", id, "role", configuredRole, "err", err)
+		return user.Role, false, err
+	}
+	slog.Info("granted configured role", "userID", id, "role", configuredRole)
+
+	return configuredRole, true, nil
+}
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// SetRole changes the role of the user, unlike LoginRole
+// it can also take roles away
+func (uh *UserHandler) SetRole(id string, role string) error {
+	if _, ok := roleRank[role]; !ok {
+		return ErrUnknownRole
+	}
+	return uh.updateRole(id, role)
+}
+
 func (uh *UserHandler) RetrieveUserMap() (map[string]User, error) {
 	users, err := uh.queryAllUsers()
 	if err != nil {
-		log.Error.Printf("Error retrieving users: %v", err)
+		slog.Error("error retrieving users", "err", err)
 		return nil, err
 	}
 	return uh.userSliceToMap(users), nil
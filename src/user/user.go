@@ -1,13 +1,89 @@
 package user
 
+import "time"
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
 type User struct {
 	ID    string
 	Name  string
 	Email string
+	Role  string
+}
+
+// Suspension of a user, suspended users cannot log in
+// and are logged out on their next request
+type Suspension struct {
+	Suspended bool
+	// Until is the zero time if the suspension does not end
+	Until time.Time
+}
+
+// Profile is what the identity provider knows about the user,
+// it is synced on every login
+type Profile struct {
+	ID             string
+	Name           string
+	Email          string
+	GivenName      string
+	Surname        string
+	JobTitle       string
+	OfficeLocation string
+}
+
+// ProfileChange is an entry of the profile history,
+// e.g. the old name of a renamed user
+type ProfileChange struct {
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+// changes lists the fields that differ in the newer profile
+func (p Profile) changes(newer Profile) []ProfileChange {
+	fields := []struct {
+		name       string
+		old, newer string
+	}{
+		{"name", p.Name, newer.Name},
+		{"email", p.Email, newer.Email},
+		{"given_name", p.GivenName, newer.GivenName},
+		{"surname", p.Surname, newer.Surname},
+		{"job_title", p.JobTitle, newer.JobTitle},
+		{"office_location", p.OfficeLocation, newer.OfficeLocation},
+	}
+
+	var changes []ProfileChange
+	for _, field := range fields {
+		if field.old != field.newer {
+			changes = append(changes, ProfileChange{Field: field.name, OldValue: field.old, NewValue: field.newer})
+		}
+	}
+	return changes
 }
 
 var NullUser = User{
 	ID:    "null",
 	Name:  "null",
 	Email: "null",
+	Role:  RoleUser,
+}
+
+// IsModerator is true for moderators and admins
+func (u User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
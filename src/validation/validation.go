@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	TitleMinLength       = 3
+	TitleMaxLength       = 200
+	URLMaxLength         = 2000
+	DescriptionMaxLength = 10000
+	CommentMaxLength     = 5000
+	TagMaxLength         = 30
+	TagsMaxCount         = 5
+	NoteMaxLength        = 1000
+	PollOptionsMinCount  = 2
+	PollOptionsMaxCount  = 10
+	PollOptionMaxLength  = 200
+)
+
+// Errors maps a form field name to the message shown next to it
+type Errors map[string]string
+
+// Check records message for field if ok is false.
+// Only the first failing rule of a field is kept.
+func (e Errors) Check(ok bool, field string, message string) {
+	if ok {
+		return
+	}
+	if _, exists := e[field]; exists {
+		return
+	}
+	e[field] = message
+}
+
+func (e Errors) Valid() bool {
+	return len(e) == 0
+}
+
+func (e Errors) Title(field string, value string) {
+	e.Check(NotBlank(value), field, "Title is required")
+	e.Check(MinLength(value, TitleMinLength), field, "Title is too short")
+	e.Check(MaxLength(value, TitleMaxLength), field, "Title is too long")
+}
+
+// URL accepts an empty value, links are optional
+func (e Errors) URL(field string, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	e.Check(MaxLength(value, URLMaxLength), field, "URL is too long")
+	e.Check(WebURL(value), field, "URL must be a valid http or https link")
+}
+
+func (e Errors) Description(field string, value string) {
+	e.Check(MaxLength(value, DescriptionMaxLength), field, "Description is too long")
+}
+
+func (e Errors) Comment(field string, value string) {
+	e.Check(NotBlank(value), field, "Comment must not be empty")
+	e.Check(MaxLength(value, CommentMaxLength), field, "Comment is too long")
+}
+
+func (e Errors) Note(field string, value string) {
+	e.Check(MaxLength(value, NoteMaxLength), field, "Note is too long")
+}
+
+// Tags expects already normalized tag names
+func (e Errors) Tags(field string, names []string) {
+	e.Check(len(names) <= TagsMaxCount, field, "Use at most "+strconv.Itoa(TagsMaxCount)+" tags")
+	for _, name := range names {
+		e.Check(MaxLength(name, TagMaxLength), field, "Tag '"+name+"' is too long")
+	}
+}
+
+func (e Errors) PollOptions(field string, options []string) {
+	e.Check(len(options) >= PollOptionsMinCount, field, "A poll needs at least "+strconv.Itoa(PollOptionsMinCount)+" options")
+	e.Check(len(options) <= PollOptionsMaxCount, field, "Use at most "+strconv.Itoa(PollOptionsMaxCount)+" options")
+	for _, option := range options {
+		e.Check(MaxLength(option, PollOptionMaxLength), field, "Option '"+option+"' is too long")
+	}
+}
+
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+func MinLength(value string, min int) bool {
+	return utf8.RuneCountInString(strings.TrimSpace(value)) >= min
+}
+
+func MaxLength(value string, max int) bool {
+	return utf8.RuneCountInString(value) <= max
+}
+
+// WebURL reports whether value is an absolute http(s) url with a host.
+// A missing scheme is accepted since "example.com" is how people type links.
+func WebURL(value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, " \t\n") {
+		return false
+	}
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return false
+	}
+
+	return u.Hostname() != ""
+}
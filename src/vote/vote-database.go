@@ -1,8 +1,9 @@
 package vote
 
 import (
-	"agora/src/log"
+	"agora/src/event"
 	"database/sql"
+	"log/slog"
 )
 
 type VoteRecord struct {
@@ -38,17 +39,31 @@ func (vh *VoteHandler) QueryNrOfVotesPerPostAndUser(postID int64, userID string)
 		userID,
 	).Scan(&count)
 	if err != nil {
-		log.Error.Printf("Error querying number of votes: %v", err)
+		slog.Error("error querying number of votes", "err", err)
 		return 0, err
 	}
 	return int(count), nil
 }
 
+// QueryPostIDOfComment returns the post a comment was written on,
+// sql.ErrNoRows if the comment does not exist
+func (vh *VoteHandler) QueryPostIDOfComment(commentID int64) (int64, error) {
+	var postID int64
+	err := vh.db.QueryRow(
+		`SELECT fk_post_id FROM comments WHERE id = ?`,
+		commentID,
+	).Scan(&postID)
+	if err != nil {
+		return 0, err
+	}
+	return postID, nil
+}
+
 func (vh *VoteHandler) CreateDBTable() error {
 	// Create the votes table if it doesn't exist
 	_, err := vh.db.Exec(TABLE_QUERY)
 	if err != nil {
-		log.Error.Printf("Error creating votes table: %v", err)
+		slog.Error("error creating votes table", "err", err)
 		return err
 	}
 	return nil
@@ -64,9 +79,16 @@ func (vh *VoteHandler) InsertNewVote(record VoteInsertRecord) (int64, error) {
 		record.UserID,
 	)
 	if err != nil {
-		log.Error.Printf("Error inserting new vote: %v", err)
+		slog.Error("error inserting new vote", "err", err)
 		return 0, err
 	}
+
+	vh.bus.Publish(event.VoteCreated, event.VoteCreatedPayload{
+		PostID:    record.PostID.Int64,
+		CommentID: record.CommentID.Int64,
+		UserID:    record.UserID,
+	})
+
 	return result.LastInsertId()
 }
 
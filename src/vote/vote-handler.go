@@ -2,18 +2,21 @@ package vote
 
 import (
 	"agora/src/db"
+	"agora/src/event"
 	"agora/src/post"
 )
 
 type VoteHandler struct {
-	db *db.DB
-	ph *post.PostHandler
+	db  *db.DB
+	ph  *post.PostHandler
+	bus *event.Bus
 }
 
-func NewVoteHandler(db *db.DB, ph *post.PostHandler) *VoteHandler {
+func NewVoteHandler(db *db.DB, ph *post.PostHandler, bus *event.Bus) *VoteHandler {
 	return &VoteHandler{
-		db: db,
-		ph: ph,
+		db:  db,
+		ph:  ph,
+		bus: bus,
 	}
 }
 
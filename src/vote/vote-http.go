@@ -1,9 +1,9 @@
 package vote
 
 import (
-	"agora/src/log"
 	"agora/src/server/auth"
 	"database/sql"
+	"log/slog"
 	"net/http"
 	"strconv"
 )
@@ -28,7 +28,7 @@ func (vh *VoteHandler) VotePOSTHandler(w http.ResponseWriter, r *http.Request) {
 	if postIDStr != "" {
 		postIDint, err := strconv.Atoi(postIDStr)
 		if err != nil {
-			log.Error.Printf("msg='could not convert post_id from string to int' postID='%s'\n", postIDStr)
+			slog.ErrorContext(r.Context(), "could not convert post_id from string to int", "postID", postIDStr)
 			http.Error(w, "Invalid post ID", http.StatusBadRequest)
 			return
 		}
@@ -42,7 +42,7 @@ func (vh *VoteHandler) VotePOSTHandler(w http.ResponseWriter, r *http.Request) {
 	if commentIDStr != "" {
 		commentIDint, err := strconv.Atoi(commentIDStr)
 		if err != nil {
-			log.Error.Printf("msg='could not convert comment_id from string to int' commentID='%s'\n", commentIDStr)
+			slog.ErrorContext(r.Context(), "could not convert comment_id from string to int", "commentID", commentIDStr)
 			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
 			return
 		}
@@ -52,15 +52,42 @@ func (vh *VoteHandler) VotePOSTHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// comment votes have no post id, the lock of the comment's post applies
+	lockedPostID := postID.Int64
+	if commentID.Valid {
+		commentPostID, err := vh.QueryPostIDOfComment(commentID.Int64)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "could not query post of comment", "commentID", commentID.Int64, "err", err)
+			http.Error(w, "Could not vote", http.StatusInternalServerError)
+			return
+		}
+		lockedPostID = commentPostID
+	}
+
+	locked, err := vh.ph.PostIsLocked(int(lockedPostID))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not check if post is locked", "postID", lockedPostID, "err", err)
+		http.Error(w, "Could not vote", http.StatusInternalServerError)
+		return
+	}
+	if locked {
+		http.Error(w, "This post is locked by a moderator, new votes are not allowed", http.StatusForbidden)
+		return
+	}
+
 	nrOfVotes, err := vh.QueryNrOfVotesPerPostAndUser(postID.Int64, user.ID)
 	if err != nil {
-		log.Error.Printf("msg='could not query number of votes' err='%s'\n", err.Error())
+		slog.ErrorContext(r.Context(), "could not query number of votes", "err", err)
 		http.Error(w, "Could not vote", http.StatusInternalServerError)
 		return
 	}
 
 	if nrOfVotes > 0 {
-		log.Error.Printf("msg='user already voted' user='%s' postID='%d' commentID='%d'\n", user.ID, postID.Int64, commentID.Int64)
+		slog.ErrorContext(r.Context(), "user already voted", "user", user.ID, "postID", postID.Int64, "commentID", commentID.Int64)
 		http.Error(w, "You have already voted", http.StatusBadRequest)
 		return
 	}
@@ -73,7 +100,7 @@ func (vh *VoteHandler) VotePOSTHandler(w http.ResponseWriter, r *http.Request) {
 
 	_, err = vh.InsertNewVote(newVote)
 	if err != nil {
-		log.Error.Printf("msg='could not insert new vote' err='%s'\n", err.Error())
+		slog.ErrorContext(r.Context(), "could not insert new vote", "err", err)
 		http.Error(w, "Could not process vote", http.StatusInternalServerError)
 		return
 	}
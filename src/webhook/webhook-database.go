@@ -0,0 +1,296 @@
+package webhook
+
+import (
+	"agora/src/event"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+const TABLE_QUERY = `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL,
+		active BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		fk_created_by TEXT,
+
+		CONSTRAINT "fk_created_by" FOREIGN KEY("fk_created_by") REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		fk_webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME,
+
+		CONSTRAINT "fk_webhook_id" FOREIGN KEY("fk_webhook_id") REFERENCES webhooks(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(delivered_at, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(fk_webhook_id, id);
+`
+
+func (wh *WebhookHandler) CreateDBTable() error {
+	_, err := wh.db.Exec(TABLE_QUERY)
+	if err != nil {
+		slog.Error("error creating webhook tables", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (wh *WebhookHandler) insertWebhook(url string, secret string, events []event.Topic, createdBy string) (int64, error) {
+	result, err := wh.db.Exec(
+		`INSERT INTO webhooks (url, secret, events, fk_created_by) VALUES (?, ?, ?, ?)`,
+		url,
+		secret,
+		joinTopics(events),
+		createdBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// queryAllWebhooks also counts the deliveries that were given up on
+// and returns the status code of the latest attempt
+func (wh *WebhookHandler) queryAllWebhooks() ([]Webhook, error) {
+	rows, err := wh.db.Query(
+		`SELECT
+			w.id, w.url, w.secret, w.events, w.active, w.created_at,
+			COALESCE(u.name, ''),
+			(SELECT COUNT(*) FROM webhook_deliveries d
+			 WHERE d.fk_webhook_id = w.id AND d.delivered_at IS NULL AND d.attempts >= ?),
+			COALESCE((SELECT d.status_code FROM webhook_deliveries d
+			 WHERE d.fk_webhook_id = w.id AND d.attempts > 0
+			 ORDER BY d.id DESC LIMIT 1), 0)
+		 FROM webhooks w
+		 LEFT JOIN users u ON u.id = w.fk_created_by
+		 ORDER BY w.id`,
+		maxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.URL,
+			&webhook.Secret,
+			&events,
+			&webhook.Active,
+			&webhook.CreatedAt,
+			&webhook.FCreatedByName,
+			&webhook.FFailedCount,
+			&webhook.FLastStatusCode,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = splitTopics(events)
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func (wh *WebhookHandler) queryActiveWebhooks() ([]Webhook, error) {
+	rows, err := wh.db.Query(`SELECT id, url, events FROM webhooks WHERE active`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var webhook Webhook
+		var events string
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &events); err != nil {
+			return nil, err
+		}
+		webhook.Events = splitTopics(events)
+		webhook.Active = true
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+func (wh *WebhookHandler) queryWebhook(id int64) (Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := wh.db.QueryRow(
+		`SELECT id, url, events, active, created_at FROM webhooks WHERE id = ?`,
+		id,
+	).Scan(&webhook.ID, &webhook.URL, &events, &webhook.Active, &webhook.CreatedAt)
+	webhook.Events = splitTopics(events)
+	return webhook, err
+}
+
+func (wh *WebhookHandler) toggleWebhook(id int64) error {
+	_, err := wh.db.Exec(`UPDATE webhooks SET active = NOT active WHERE id = ?`, id)
+	return err
+}
+
+func (wh *WebhookHandler) deleteWebhook(id int64) error {
+	tx, err := wh.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE fk_webhook_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (wh *WebhookHandler) insertDelivery(webhookID int64, topic event.Topic, payload string) error {
+	_, err := wh.db.Exec(
+		`INSERT INTO webhook_deliveries (fk_webhook_id, event, payload) VALUES (?, ?, ?)`,
+		webhookID,
+		topic,
+		payload,
+	)
+	return err
+}
+
+// queryDueDeliveries skips webhooks that were deactivated,
+// their deliveries are sent once they are active again
+func (wh *WebhookHandler) queryDueDeliveries() ([]dueDelivery, error) {
+	rows, err := wh.db.Query(
+		`SELECT d.id, d.fk_webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+		 FROM webhook_deliveries d
+		 JOIN webhooks w ON w.id = d.fk_webhook_id
+		 WHERE w.active
+		 AND d.delivered_at IS NULL
+		 AND d.attempts < ?
+		 AND d.next_attempt_at <= CURRENT_TIMESTAMP
+		 ORDER BY d.id
+		 LIMIT 50`,
+		maxAttempts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []dueDelivery
+	for rows.Next() {
+		var delivery dueDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// queryDeliveries returns the latest deliveries of a webhook, newest first
+func (wh *WebhookHandler) queryDeliveries(webhookID int64, failedOnly bool) ([]Delivery, error) {
+	rows, err := wh.db.Query(
+		`SELECT id, fk_webhook_id, event, payload, attempts,
+			COALESCE(status_code, 0), COALESCE(last_error, ''),
+			created_at, next_attempt_at, delivered_at
+		 FROM webhook_deliveries
+		 WHERE fk_webhook_id = ?
+		 AND (NOT ? OR (delivered_at IS NULL AND attempts > 0))
+		 ORDER BY id DESC
+		 LIMIT 100`,
+		webhookID,
+		failedOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var delivery Delivery
+		var deliveredAt sql.NullString
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.StatusCode,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.NextAttempt,
+			&deliveredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.DeliveredAt = deliveredAt.String
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (wh *WebhookHandler) markDelivered(id int64, statusCode int) error {
+	_, err := wh.db.Exec(
+		`UPDATE webhook_deliveries
+		 SET delivered_at = CURRENT_TIMESTAMP, attempts = attempts + 1, status_code = ?, last_error = NULL
+		 WHERE id = ?`,
+		statusCode,
+		id,
+	)
+	return err
+}
+
+func (wh *WebhookHandler) markFailed(id int64, attempts int, retryIn time.Duration, statusCode int, lastError string) error {
+	_, err := wh.db.Exec(
+		`UPDATE webhook_deliveries
+		 SET attempts = ?, status_code = ?, last_error = ?, next_attempt_at = datetime('now', '+' || ? || ' seconds')
+		 WHERE id = ?`,
+		attempts,
+		sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0},
+		lastError,
+		int(retryIn.Seconds()),
+		id,
+	)
+	return err
+}
+
+// retryDelivery resets the attempts so a given up delivery is sent again
+func (wh *WebhookHandler) retryDelivery(webhookID int64, deliveryID int64) error {
+	_, err := wh.db.Exec(
+		`UPDATE webhook_deliveries
+		 SET attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND fk_webhook_id = ? AND delivered_at IS NULL`,
+		deliveryID,
+		webhookID,
+	)
+	return err
+}
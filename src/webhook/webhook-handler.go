@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"agora/src/audit"
+	"agora/src/db"
+	"agora/src/event"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const pollInterval = 15 * time.Second
+const maxAttempts = 8
+const requestTimeout = 10 * time.Second
+
+// WebhookHandler stores a delivery per subscribed webhook for every
+// event and posts them in the background, failed posts are retried with backoff
+type WebhookHandler struct {
+	db      *db.DB
+	ah      *audit.AuditHandler
+	baseURL string
+	client  *http.Client
+
+	// wake makes the worker deliver right away instead of waiting for the next tick
+	wake    chan struct{}
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func NewWebhookHandler(db *db.DB, ah *audit.AuditHandler, baseURL string, bus *event.Bus) *WebhookHandler {
+	wh := &WebhookHandler{
+		db:      db,
+		ah:      ah,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: requestTimeout},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+	for _, topic := range event.Topics {
+		bus.Subscribe(topic, wh.onEvent)
+	}
+	return wh
+}
+
+func (wh *WebhookHandler) Start() {
+	wh.stopped.Add(1)
+	go func() {
+		defer wh.stopped.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			wh.sendDueDeliveries()
+
+			select {
+			case <-ticker.C:
+			case <-wh.wake:
+			case <-wh.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the delivery currently being sent, pending deliveries
+// stay in the database and are sent after the next start
+func (wh *WebhookHandler) Stop() {
+	close(wh.stop)
+	wh.stopped.Wait()
+}
+
+func (wh *WebhookHandler) wakeUp() {
+	select {
+	case wh.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (wh *WebhookHandler) sendDueDeliveries() {
+	deliveries, err := wh.queryDueDeliveries()
+	if err != nil {
+		slog.Error("could not query webhook deliveries", "err", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		statusCode, err := wh.send(delivery)
+		if err == nil {
+			if err := wh.markDelivered(delivery.ID, statusCode); err != nil {
+				slog.Error("could not mark webhook delivery as delivered", "id", delivery.ID, "err", err)
+			}
+			continue
+		}
+
+		attempts := delivery.Attempts + 1
+		slog.Warn("could not deliver webhook", "id", delivery.ID, "url", delivery.URL, "attempt", attempts, "err", err)
+		if err := wh.markFailed(delivery.ID, attempts, backoff(attempts), statusCode, err.Error()); err != nil {
+			slog.Error("could not update webhook delivery", "id", delivery.ID, "err", err)
+		}
+	}
+}
+
+// send posts the payload and returns the status code of the response,
+// anything but a 2xx is an error
+func (wh *WebhookHandler) send(delivery dueDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Agora-Webhook")
+	request.Header.Set("X-Agora-Event", string(delivery.Event))
+	request.Header.Set("X-Agora-Delivery", strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set("X-Agora-Signature", Sign(delivery.Secret, body))
+
+	response, err := wh.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign returns the value of the X-Agora-Signature header.
+// Receivers compute the HMAC-SHA256 of the raw body with the
+// shared secret and compare it to the hex digest after "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff doubles the wait time with every attempt, starting at 30 seconds
+func backoff(attempts int) time.Duration {
+	return 30 * time.Second * time.Duration(1<<(attempts-1))
+}
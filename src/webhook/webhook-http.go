@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"agora/src/audit"
+	"agora/src/event"
+	"agora/src/render"
+	"agora/src/server/auth"
+	"agora/src/validation"
+	"crypto/rand"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed webhook-list.html
+var webhookListTemplate string
+
+//go:embed webhook-deliveries.html
+var webhookDeliveriesTemplate string
+
+func (wh *WebhookHandler) WebhookListGETHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	webhooks, err := wh.queryAllWebhooks()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query webhooks", "err", err)
+		http.Error(w, "Could not retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(
+		w,
+		"webhook-list.html",
+		&render.Page{
+			Title: "Webhooks",
+			Data: struct {
+				Webhooks []Webhook
+				Topics   []event.Topic
+				Error    string
+			}{
+				Webhooks: webhooks,
+				Topics:   event.Topics,
+				Error:    listErrors[r.URL.Query().Get("error")],
+			},
+		},
+		r.Context(),
+		webhookListTemplate,
+	)
+}
+
+func (wh *WebhookHandler) WebhookCreatePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsAdmin() {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	targetURL := strings.TrimSpace(r.FormValue("url"))
+	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") || !validation.WebURL(targetURL) {
+		redirectToListWithError(w, r, errInvalidURL)
+		return
+	}
+
+	var events []event.Topic
+	for _, name := range r.Form["events"] {
+		topic := event.Topic(name)
+		if slices.Contains(event.Topics, topic) && !slices.Contains(events, topic) {
+			events = append(events, topic)
+		}
+	}
+	if len(events) == 0 {
+		redirectToListWithError(w, r, errNoEvents)
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not generate webhook secret", "err", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	webhookID, err := wh.insertWebhook(targetURL, secret, events, user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not create webhook", "url", targetURL, "err", err)
+		http.Error(w, "Could not create webhook", http.StatusInternalServerError)
+		return
+	}
+
+	wh.ah.Record(r, user.ID, audit.WebhookCreated, audit.WebhookTarget(webhookID), "url="+targetURL+" events="+joinTopics(events))
+	slog.InfoContext(r.Context(), "created webhook", "url", targetURL, "events", joinTopics(events), "userID", user.ID)
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (wh *WebhookHandler) WebhookTogglePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsAdmin() {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := wh.toggleWebhook(webhookID); err != nil {
+		slog.ErrorContext(r.Context(), "could not toggle webhook", "webhookID", webhookID, "err", err)
+		http.Error(w, "Could not update webhook", http.StatusInternalServerError)
+		return
+	}
+
+	wh.ah.Record(r, user.ID, audit.WebhookToggled, audit.WebhookTarget(webhookID), "")
+	wh.wakeUp()
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (wh *WebhookHandler) WebhookDeletePOSTHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	if !ok || !user.IsAdmin() {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := wh.deleteWebhook(webhookID); err != nil {
+		slog.ErrorContext(r.Context(), "could not delete webhook", "webhookID", webhookID, "err", err)
+		http.Error(w, "Could not delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	wh.ah.Record(r, user.ID, audit.WebhookDeleted, audit.WebhookTarget(webhookID), "")
+	slog.InfoContext(r.Context(), "deleted webhook", "webhookID", webhookID, "userID", user.ID)
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (wh *WebhookHandler) WebhookDeliveriesGETHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := wh.queryWebhook(webhookID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query webhook", "webhookID", webhookID, "err", err)
+		http.Error(w, "Could not retrieve webhook", http.StatusInternalServerError)
+		return
+	}
+
+	failedOnly := r.URL.Query().Get("failed") != ""
+	deliveries, err := wh.queryDeliveries(webhookID, failedOnly)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "could not query webhook deliveries", "webhookID", webhookID, "err", err)
+		http.Error(w, "Could not retrieve deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	render.RenderTemplate(
+		w,
+		"webhook-deliveries.html",
+		&render.Page{
+			Title: "Webhook Deliveries",
+			Data: struct {
+				Webhook    Webhook
+				Deliveries []Delivery
+				FailedOnly bool
+			}{
+				Webhook:    webhook,
+				Deliveries: deliveries,
+				FailedOnly: failedOnly,
+			},
+		},
+		r.Context(),
+		webhookDeliveriesTemplate,
+	)
+}
+
+func (wh *WebhookHandler) WebhookRetryPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Only admins can manage webhooks", http.StatusForbidden)
+		return
+	}
+
+	vars := mux.Vars(r)
+	webhookID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(vars["delivery"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := wh.retryDelivery(webhookID, deliveryID); err != nil {
+		slog.ErrorContext(r.Context(), "could not retry webhook delivery", "deliveryID", deliveryID, "err", err)
+		http.Error(w, "Could not retry delivery", http.StatusInternalServerError)
+		return
+	}
+
+	wh.wakeUp()
+	http.Redirect(w, r, "/admin/webhooks/"+vars["id"]+"/deliveries", http.StatusSeeOther)
+}
+
+func isAdmin(r *http.Request) bool {
+	user, ok := auth.ExtractUserFromContext(r.Context())
+	return ok && user.IsAdmin()
+}
+
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// The list shows errors by code, a message in the URL
+// would end up in the page as it is
+const (
+	errInvalidURL = "invalid-url"
+	errNoEvents   = "no-events"
+)
+
+var listErrors = map[string]string{
+	errInvalidURL: "The webhook URL must be an absolute http or https link",
+	errNoEvents:   "Choose at least one event",
+}
+
+func redirectToListWithError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, "/admin/webhooks?error="+code, http.StatusSeeOther)
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"agora/src/event"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"time"
+)
+
+// Payload is the JSON body of every delivery.
+// Post is always set, Comment for comments and votes on comments
+// and Voter only for votes.
+type Payload struct {
+	Event      event.Topic     `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Post       *PostPayload    `json:"post"`
+	Comment    *CommentPayload `json:"comment,omitempty"`
+	Voter      *AuthorPayload  `json:"voter,omitempty"`
+}
+
+type PostPayload struct {
+	ID          int64         `json:"id"`
+	Title       string        `json:"title"`
+	URL         string        `json:"url"`
+	Description string        `json:"description"`
+	Link        string        `json:"link"`
+	CreatedAt   string        `json:"created_at"`
+	Author      AuthorPayload `json:"author"`
+}
+
+type CommentPayload struct {
+	ID        int64         `json:"id"`
+	ParentID  int64         `json:"parent_id,omitempty"`
+	Text      string        `json:"text"`
+	Link      string        `json:"link"`
+	CreatedAt string        `json:"created_at"`
+	Author    AuthorPayload `json:"author"`
+}
+
+type AuthorPayload struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func (wh *WebhookHandler) onEvent(e event.Event) {
+	webhooks, err := wh.queryActiveWebhooks()
+	if err != nil {
+		slog.Error("could not query webhooks", "topic", e.Topic, "err", err)
+		return
+	}
+
+	var subscribed []Webhook
+	for _, webhook := range webhooks {
+		if webhook.Subscribes(e.Topic) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return
+	}
+
+	payload, err := wh.buildPayload(e)
+	if err != nil {
+		slog.Error("could not build webhook payload", "topic", e.Topic, "payload", e.Payload, "err", err)
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("could not encode webhook payload", "topic", e.Topic, "err", err)
+		return
+	}
+
+	for _, webhook := range subscribed {
+		if err := wh.insertDelivery(webhook.ID, e.Topic, string(body)); err != nil {
+			slog.Error("could not queue webhook delivery", "webhookID", webhook.ID, "topic", e.Topic, "err", err)
+		}
+	}
+	wh.wakeUp()
+}
+
+func (wh *WebhookHandler) buildPayload(e event.Event) (Payload, error) {
+	payload := Payload{Event: e.Topic, OccurredAt: e.OccurredAt}
+
+	var postID, commentID int64
+	switch p := e.Payload.(type) {
+	case event.PostCreatedPayload:
+		postID = p.PostID
+	case event.CommentCreatedPayload:
+		postID = int64(p.PostID)
+		commentID = p.CommentID
+	case event.VoteCreatedPayload:
+		postID = p.PostID
+		commentID = p.CommentID
+
+		voter, err := wh.queryAuthor(p.UserID)
+		if err != nil {
+			return Payload{}, err
+		}
+		payload.Voter = &voter
+	default:
+		return Payload{}, fmt.Errorf("unexpected payload %T", e.Payload)
+	}
+
+	if commentID != 0 {
+		comment, commentPostID, err := wh.queryCommentPayload(commentID)
+		if err != nil {
+			return Payload{}, err
+		}
+		payload.Comment = &comment
+		postID = commentPostID
+	}
+
+	post, err := wh.queryPostPayload(postID)
+	if err != nil {
+		return Payload{}, err
+	}
+	payload.Post = &post
+
+	return payload, nil
+}
+
+func (wh *WebhookHandler) queryPostPayload(postID int64) (PostPayload, error) {
+	var post PostPayload
+	var url, description sql.NullString
+	err := wh.db.QueryRow(
+		`SELECT p.id, p.title, p.url, p.description, p.created_at, u.id, u.name, u.email
+		 FROM posts p
+		 JOIN users u ON u.id = p.fk_user_id
+		 WHERE p.id = ?`,
+		postID,
+	).Scan(
+		&post.ID,
+		&post.Title,
+		&url,
+		&description,
+		&post.CreatedAt,
+		&post.Author.ID,
+		&post.Author.Name,
+		&post.Author.Email,
+	)
+	if err != nil {
+		return PostPayload{}, err
+	}
+
+	post.Title = html.UnescapeString(post.Title)
+	post.URL = url.String
+	post.Description = html.UnescapeString(description.String)
+	post.Link = fmt.Sprintf("%s/posts/%d", wh.baseURL, post.ID)
+	return post, nil
+}
+
+func (wh *WebhookHandler) queryCommentPayload(commentID int64) (CommentPayload, int64, error) {
+	var comment CommentPayload
+	var postID int64
+	var parentID sql.NullInt64
+	err := wh.db.QueryRow(
+		`SELECT c.id, c.fk_post_id, c.fk_parent_id, c.text, c.created_at, u.id, u.name, u.email
+		 FROM comments c
+		 JOIN users u ON u.id = c.fk_user_id
+		 WHERE c.id = ?`,
+		commentID,
+	).Scan(
+		&comment.ID,
+		&postID,
+		&parentID,
+		&comment.Text,
+		&comment.CreatedAt,
+		&comment.Author.ID,
+		&comment.Author.Name,
+		&comment.Author.Email,
+	)
+	if err != nil {
+		return CommentPayload{}, 0, err
+	}
+
+	comment.ParentID = parentID.Int64
+	comment.Text = html.UnescapeString(comment.Text)
+	comment.Link = fmt.Sprintf("%s/posts/%d/#comment-%d", wh.baseURL, postID, comment.ID)
+	return comment, postID, nil
+}
+
+func (wh *WebhookHandler) queryAuthor(userID string) (AuthorPayload, error) {
+	var author AuthorPayload
+	err := wh.db.QueryRow(
+		`SELECT id, name, email FROM users WHERE id = ?`,
+		userID,
+	).Scan(&author.ID, &author.Name, &author.Email)
+	return author, err
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"agora/src/event"
+	"strings"
+)
+
+// Webhook is an endpoint outside of Agora that gets a signed
+// JSON POST for every event it subscribed to
+type Webhook struct {
+	ID        int64
+	URL       string
+	Secret    string
+	Events    []event.Topic
+	Active    bool
+	CreatedAt string
+
+	FCreatedByName  string
+	FFailedCount    int
+	FLastStatusCode int
+}
+
+func (w Webhook) Subscribes(topic event.Topic) bool {
+	for _, subscribed := range w.Events {
+		if subscribed == topic {
+			return true
+		}
+	}
+	return false
+}
+
+type Delivery struct {
+	ID          int64
+	WebhookID   int64
+	Event       event.Topic
+	Payload     string
+	Attempts    int
+	StatusCode  int
+	LastError   string
+	CreatedAt   string
+	NextAttempt string
+	DeliveredAt string
+}
+
+func (d Delivery) Delivered() bool {
+	return d.DeliveredAt != ""
+}
+
+func (d Delivery) GaveUp() bool {
+	return !d.Delivered() && d.Attempts >= maxAttempts
+}
+
+type dueDelivery struct {
+	Delivery
+	URL    string
+	Secret string
+}
+
+func joinTopics(topics []event.Topic) string {
+	names := make([]string, len(topics))
+	for i, topic := range topics {
+		names[i] = string(topic)
+	}
+	return strings.Join(names, ",")
+}
+
+func splitTopics(value string) []event.Topic {
+	var topics []event.Topic
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			topics = append(topics, event.Topic(name))
+		}
+	}
+	return topics
+}
@@ -0,0 +1,79 @@
+package canonical
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var ErrNoHost = errors.New("url has no host")
+
+// URL normalizes a link so that trivially different spellings
+// of the same resource end up as the same string:
+// https://www.Example.com/a/?utm_source=x#top -> https://example.com/a
+func URL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Host == "" {
+		return "", ErrNoHost
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "http" {
+		scheme = "https"
+	}
+	u.Scheme = scheme
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	port := u.Port()
+	if port != "" && port != "80" && port != "443" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+	u.RawQuery = canonicalQuery(u.Query())
+
+	return u.String(), nil
+}
+
+func canonicalQuery(query url.Values) string {
+	for key := range query {
+		if isTrackingParam(key) {
+			query.Del(key)
+		}
+	}
+
+	// Encode sorts by key, so parameter order does not matter
+	return query.Encode()
+}
+
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ref_src": true,
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
@@ -1,10 +1,17 @@
 package date
 
 import (
-	"agora/src/log"
+	"log/slog"
 	"time"
 )
 
+// SQLite is the format of CURRENT_TIMESTAMP, dates stored
+// like this can be compared to it in queries
+const SQLite = "2006-01-02 15:04:05"
+
+// DatetimeLocal is the value format of <input type="datetime-local">
+const DatetimeLocal = "2006-01-02T15:04"
+
 func FormatDate(date string) string {
 	// 2025-06-01T20:10:16Z
 	const incomingFormat = "2006-01-02T15:04:05Z"
@@ -13,7 +20,7 @@ func FormatDate(date string) string {
 	// Parse the incoming date
 	t, err := time.Parse(incomingFormat, date)
 	if err != nil {
-		log.Error.Printf("Failed to parse date: %v\n", err)
+		slog.Error("failed to parse date", "err", err)
 		return date
 	}
 
@@ -0,0 +1,17 @@
+package redirect
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ReturnTo is the local path in the return_to form value or fallback.
+// Browsers treat //host and /\host as other sites, those are rejected
+// so forms cannot be used as an open redirect.
+func ReturnTo(r *http.Request, fallback string) string {
+	target := r.FormValue("return_to")
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return fallback
+	}
+	return target
+}